@@ -0,0 +1,71 @@
+package assembler
+
+import (
+	"strconv"
+
+	"github.com/youchann/nand2tetris/06/code"
+	"github.com/youchann/nand2tetris/06/parser"
+	"github.com/youchann/nand2tetris/06/symboltable"
+)
+
+// Assemble translates Hack assembly into machine code, one binary string
+// per instruction. It also returns the variables it allocated, in
+// allocation order, and the symbol table that resolves them.
+func Assemble(content string) ([]string, []string, *symboltable.Table, error) {
+	st := firstPassAssemble(content)
+	machineCode, variables, err := secondPassAssemble(content, st)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return machineCode, variables, st, nil
+}
+
+func firstPassAssemble(content string) *symboltable.Table {
+	st := symboltable.New()
+	p := parser.New(content)
+	romAddress := 0
+	for p.HasMoreLines() {
+		switch p.CommandType() {
+		case parser.A_INSTRUCTION, parser.C_INSTRUCTION:
+			romAddress++
+		case parser.L_INSTRUCTION:
+			st.AddEntry(p.Symbol(), romAddress)
+		}
+		p.Advance()
+	}
+	return st
+}
+
+// secondPassAssemble returns the machine code along with the variables it
+// allocated, in allocation order.
+func secondPassAssemble(content string, symbolTable *symboltable.Table) ([]string, []string, error) {
+	var machineCode []string
+	var variables []string
+	p := parser.New(content)
+	currentRAMAddress := 16
+	for p.HasMoreLines() {
+		var instruction string
+		switch p.CommandType() {
+		case parser.A_INSTRUCTION:
+			s := p.Symbol()
+			if _, err := strconv.Atoi(s); err != nil {
+				if !symbolTable.Contains(s) {
+					symbolTable.AddEntry(s, currentRAMAddress)
+					variables = append(variables, s)
+					currentRAMAddress++
+				}
+				s = strconv.Itoa(symbolTable.GetAddress(s))
+			}
+			instruction = code.Symbol(s)
+		case parser.C_INSTRUCTION:
+			instruction = "111" + code.Comp(p.Comp()) + code.Dest(p.Dest()) + code.Jump(p.Jump())
+		case parser.L_INSTRUCTION: // first pass already handled this
+		}
+		if instruction != "" {
+			machineCode = append(machineCode, instruction)
+		}
+		p.Advance()
+	}
+
+	return machineCode, variables, nil
+}
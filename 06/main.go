@@ -1,14 +1,14 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
-	"github.com/youchann/nand2tetris/06/code"
-	"github.com/youchann/nand2tetris/06/parser"
+	"github.com/youchann/nand2tetris/06/assembler"
 	"github.com/youchann/nand2tetris/06/symboltable"
 )
 
@@ -20,50 +20,43 @@ func getHackFilePath(asmPath string) string {
 	return filepath.Join(dir, hackName)
 }
 
-func firstPassAssemble(content string) *symboltable.Table {
-	st := symboltable.New()
-	p := parser.New(content)
-	romAddress := 0
-	for p.HasMoreLines() {
-		switch p.CommandType() {
-		case parser.A_INSTRUCTION, parser.C_INSTRUCTION:
-			romAddress++
-		case parser.L_INSTRUCTION:
-			st.AddEntry(p.Symbol(), romAddress)
+// printVariableAllocation prints the variables grouped by the file prefix of
+// VM static symbols such as Main.3. Other variables are grouped together.
+func printVariableAllocation(variables []string, symbolTable *symboltable.Table) {
+	var groups []string
+	count := map[string]int{}
+	first := map[string]int{}
+	last := map[string]int{}
+	for _, v := range variables {
+		group := "(variables)"
+		if idx := strings.LastIndex(v, "."); idx != -1 {
+			if _, err := strconv.Atoi(v[idx+1:]); err == nil {
+				group = v[:idx]
+			}
+		}
+		address := symbolTable.GetAddress(v)
+		if count[group] == 0 {
+			groups = append(groups, group)
+			first[group] = address
 		}
-		p.Advance()
+		count[group]++
+		last[group] = address
+	}
+	fmt.Printf("%-20s %9s  %s\n", "File", "Variables", "Addresses")
+	for _, group := range groups {
+		fmt.Printf("%-20s %9d  %d-%d\n", group, count[group], first[group], last[group])
 	}
-	return st
 }
 
-func secondPassAssemble(content string, symbolTable *symboltable.Table) ([]string, error) {
-	var machineCode []string
-	p := parser.New(content)
-	currentRAMAddress := 16
-	for p.HasMoreLines() {
-		var instruction string
-		switch p.CommandType() {
-		case parser.A_INSTRUCTION:
-			s := p.Symbol()
-			if _, err := strconv.Atoi(s); err != nil {
-				if !symbolTable.Contains(s) {
-					symbolTable.AddEntry(s, currentRAMAddress)
-					currentRAMAddress++
-				}
-				s = strconv.Itoa(symbolTable.GetAddress(s))
-			}
-			instruction = code.Symbol(s)
-		case parser.C_INSTRUCTION:
-			instruction = "111" + code.Comp(p.Comp()) + code.Dest(p.Dest()) + code.Jump(p.Jump())
-		case parser.L_INSTRUCTION: // first pass already handled this
-		}
-		if instruction != "" {
-			machineCode = append(machineCode, instruction)
+// checkVariables reports an error if a variable was allocated at or above
+// stackBase.
+func checkVariables(variables []string, symbolTable *symboltable.Table, stackBase int) error {
+	for _, v := range variables {
+		if address := symbolTable.GetAddress(v); address >= stackBase {
+			return fmt.Errorf("variable %s is at RAM %d, which overlaps the stack starting at %d", v, address, stackBase)
 		}
-		p.Advance()
 	}
-
-	return machineCode, nil
+	return nil
 }
 
 func writeToFile(filepath string, instructions []string) error {
@@ -84,12 +77,15 @@ func writeToFile(filepath string, instructions []string) error {
 }
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: go run main.go [filename]")
+	statics := flag.Bool("statics", false, "print the variable allocation and fail if it reaches the stack")
+	stackBase := flag.Int("stack-base", 256, "first stack address, checked with -statics")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Println("Usage: go run main.go [-statics] [-stack-base n] [filename]")
 		os.Exit(1)
 	}
 
-	filename := os.Args[1]
+	filename := flag.Arg(0)
 	if filepath.Ext(filename) != ".asm" {
 		fmt.Fprintf(os.Stderr, "Error: File must have .asm extension\n")
 		os.Exit(1)
@@ -101,12 +97,18 @@ func main() {
 		os.Exit(1)
 	}
 
-	st := firstPassAssemble(string(content))
-	machineCode, err := secondPassAssemble(string(content), st)
+	machineCode, variables, st, err := assembler.Assemble(string(content))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error assembling code: %v\n", err)
 		os.Exit(1)
 	}
+	if *statics {
+		printVariableAllocation(variables, st)
+		if err := checkVariables(variables, st, *stackBase); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	resultFilePath := getHackFilePath(filename)
 	err = writeToFile(resultFilePath, machineCode)
@@ -7,8 +7,8 @@ import (
 	"strings"
 
 	"github.com/youchann/nand2tetris/07/codewriter"
-	"github.com/youchann/nand2tetris/07/parser"
 	"github.com/youchann/nand2tetris/07/token"
+	"github.com/youchann/nand2tetris/vmir"
 )
 
 func getVMFilePath(asmPath string) string {
@@ -37,16 +37,21 @@ func main() {
 		os.Exit(1)
 	}
 
-	p := parser.New(string(content))
+	commands, err := vmir.Parse(strings.TrimSuffix(filepath.Base(filename), ".vm"), string(content))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 	c := codewriter.New(getVMFilePath(filename))
-	for p.HasMoreLines() {
-		switch p.CommandType() {
-		case token.C_ARITHMETIC:
-			c.WriteArithmetic(token.CommandSymbol(p.Arg1()))
-		case token.C_PUSH, token.C_POP:
-			c.WritePushPop(p.CommandType(), token.Segment(p.Arg1()), p.Arg2())
+	for _, command := range commands {
+		switch {
+		case command.Op.IsArithmetic():
+			c.WriteArithmetic(command.Op)
+		case command.Op == vmir.Push:
+			c.WritePushPop(token.C_PUSH, command.Segment, command.Index)
+		case command.Op == vmir.Pop:
+			c.WritePushPop(token.C_POP, command.Segment, command.Index)
 		}
-		p.Advance()
 	}
 	c.Close()
 }
@@ -1,5 +1,7 @@
 package token
 
+import "github.com/youchann/nand2tetris/vmir"
+
 type CommandType string
 
 const (
@@ -14,37 +16,37 @@ const (
 	// C_CALL       CommandType = "C_CALL"
 )
 
-type Segment string
+type Segment = vmir.Segment
 
 const (
-	SEGMENT_LOCAL    Segment = "local"
-	SEGMENT_ARGUMENT Segment = "argument"
-	SEGMENT_THIS     Segment = "this"
-	SEGMENT_THAT     Segment = "that"
-	SEGMENT_POINTER  Segment = "pointer"
-	SEGMENT_TEMP     Segment = "temp"
-	SEGMENT_CONSTANT Segment = "constant"
-	SEGMENT_STATIC   Segment = "static"
+	SEGMENT_LOCAL    = vmir.Local
+	SEGMENT_ARGUMENT = vmir.Argument
+	SEGMENT_THIS     = vmir.This
+	SEGMENT_THAT     = vmir.That
+	SEGMENT_POINTER  = vmir.Pointer
+	SEGMENT_TEMP     = vmir.Temp
+	SEGMENT_CONSTANT = vmir.Constant
+	SEGMENT_STATIC   = vmir.Static
 )
 
-type CommandSymbol string
+type CommandSymbol = vmir.Opcode
 
 const (
-	PUSH     CommandSymbol = "push"
-	POP      CommandSymbol = "pop"
-	LABEL    CommandSymbol = "label"
-	GOTO     CommandSymbol = "goto"
-	IF_GOTO  CommandSymbol = "if-goto"
-	CALL     CommandSymbol = "call"
-	FUNCTION CommandSymbol = "function"
-	RETURN   CommandSymbol = "return"
-	ADD      CommandSymbol = "add"
-	SUB      CommandSymbol = "sub"
-	NEG      CommandSymbol = "neg"
-	EQ       CommandSymbol = "eq"
-	GT       CommandSymbol = "gt"
-	LT       CommandSymbol = "lt"
-	AND      CommandSymbol = "and"
-	OR       CommandSymbol = "or"
-	NOT      CommandSymbol = "not"
+	PUSH     = vmir.Push
+	POP      = vmir.Pop
+	LABEL    = vmir.Label
+	GOTO     = vmir.Goto
+	IF_GOTO  = vmir.IfGoto
+	CALL     = vmir.Call
+	FUNCTION = vmir.Function
+	RETURN   = vmir.Return
+	ADD      = vmir.Add
+	SUB      = vmir.Sub
+	NEG      = vmir.Neg
+	EQ       = vmir.Eq
+	GT       = vmir.Gt
+	LT       = vmir.Lt
+	AND      = vmir.And
+	OR       = vmir.Or
+	NOT      = vmir.Not
 )
@@ -0,0 +1,330 @@
+// Package bytecode implements a compact binary form of .vm files.
+//
+// A bytecode file starts with Magic and a version byte, followed by a string
+// table and the commands:
+//
+//	strings:  uvarint count, then per string a uvarint length and its bytes
+//	commands: uvarint count, then per command an opcode byte, its operands
+//	          and the uvarint distance of its source line from the previous
+//	          command's line
+//
+// push and pop take a segment byte and a uvarint index, or a signed varint
+// for the constant segment, whose literals may be negative; label, goto and
+// if-goto take a uvarint string index; function and call take a uvarint
+// string index and a uvarint count. Arithmetic commands and return have no
+// operands.
+package bytecode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/youchann/nand2tetris/vmir"
+)
+
+// Magic starts every bytecode file.
+const Magic = "VMBC"
+
+// version 1 encoded constants as uvarints too. Decode still reads it.
+const version = 2
+
+const (
+	opAdd    byte = 0x01
+	opSub    byte = 0x02
+	opNeg    byte = 0x03
+	opEq     byte = 0x04
+	opGt     byte = 0x05
+	opLt     byte = 0x06
+	opAnd    byte = 0x07
+	opOr     byte = 0x08
+	opNot    byte = 0x09
+	opPush   byte = 0x10
+	opPop    byte = 0x11
+	opLabel  byte = 0x20
+	opGoto   byte = 0x21
+	opIf     byte = 0x22
+	opFunc   byte = 0x30
+	opCall   byte = 0x31
+	opReturn byte = 0x32
+)
+
+var arithmeticOpcodes = map[vmir.Opcode]byte{
+	vmir.Add: opAdd,
+	vmir.Sub: opSub,
+	vmir.Neg: opNeg,
+	vmir.Eq:  opEq,
+	vmir.Gt:  opGt,
+	vmir.Lt:  opLt,
+	vmir.And: opAnd,
+	vmir.Or:  opOr,
+	vmir.Not: opNot,
+}
+
+var segments = []vmir.Segment{
+	vmir.Local,
+	vmir.Argument,
+	vmir.This,
+	vmir.That,
+	vmir.Pointer,
+	vmir.Temp,
+	vmir.Constant,
+	vmir.Static,
+}
+
+var errTruncated = errors.New("unexpected end of bytecode")
+
+// IsBytecode reports whether data starts with the bytecode magic.
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// Encode serializes the commands of a file.
+func Encode(commands []vmir.Command) ([]byte, error) {
+	var stringTable []string
+	stringIndex := map[string]int{}
+	intern := func(s string) int {
+		i, ok := stringIndex[s]
+		if !ok {
+			i = len(stringTable)
+			stringTable = append(stringTable, s)
+			stringIndex[s] = i
+		}
+		return i
+	}
+
+	var code []byte
+	previousLine := 0
+	for _, command := range commands {
+		line := command.Pos.Line
+		switch command.Op {
+		case vmir.Push, vmir.Pop:
+			segment := -1
+			for i, s := range segments {
+				if command.Segment == s {
+					segment = i
+				}
+			}
+			constant := command.Segment == vmir.Constant
+			if segment < 0 || (command.Index < 0 && !constant) {
+				return nil, fmt.Errorf("line %d: cannot encode %s", line, command)
+			}
+			op := opPush
+			if command.Op == vmir.Pop {
+				op = opPop
+			}
+			code = append(code, op, byte(segment))
+			if constant {
+				code = binary.AppendVarint(code, int64(command.Index))
+			} else {
+				code = binary.AppendUvarint(code, uint64(command.Index))
+			}
+		case vmir.Label, vmir.Goto, vmir.IfGoto:
+			op := map[vmir.Opcode]byte{vmir.Label: opLabel, vmir.Goto: opGoto, vmir.IfGoto: opIf}[command.Op]
+			code = append(code, op)
+			code = binary.AppendUvarint(code, uint64(intern(command.Name)))
+		case vmir.Function, vmir.Call:
+			if command.Index < 0 {
+				return nil, fmt.Errorf("line %d: cannot encode %s", line, command)
+			}
+			op := opFunc
+			if command.Op == vmir.Call {
+				op = opCall
+			}
+			code = append(code, op)
+			code = binary.AppendUvarint(code, uint64(intern(command.Name)))
+			code = binary.AppendUvarint(code, uint64(command.Index))
+		case vmir.Return:
+			code = append(code, opReturn)
+		default:
+			op, ok := arithmeticOpcodes[command.Op]
+			if !ok {
+				return nil, fmt.Errorf("line %d: cannot encode command %q", line, command.Op)
+			}
+			code = append(code, op)
+		}
+		// Lines only grow in parsed files, but keep the encoding total.
+		line = max(line, previousLine)
+		code = binary.AppendUvarint(code, uint64(line-previousLine))
+		previousLine = line
+	}
+
+	data := []byte(Magic)
+	data = append(data, version)
+	data = binary.AppendUvarint(data, uint64(len(stringTable)))
+	for _, s := range stringTable {
+		data = binary.AppendUvarint(data, uint64(len(s)))
+		data = append(data, s...)
+	}
+	data = binary.AppendUvarint(data, uint64(len(commands)))
+	return append(data, code...), nil
+}
+
+// decoder reads bytecode sequentially.
+type decoder struct {
+	data    []byte
+	pos     int
+	version byte
+}
+
+func (d *decoder) byte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, errTruncated
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b, nil
+}
+
+func (d *decoder) uvarint() (int, error) {
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		if n == 0 {
+			return 0, errTruncated
+		}
+		return 0, fmt.Errorf("varint overflow at offset %d", d.pos)
+	}
+	if v > 1<<31 {
+		return 0, fmt.Errorf("value %d out of range at offset %d", v, d.pos)
+	}
+	d.pos += n
+	return int(v), nil
+}
+
+func (d *decoder) varint() (int, error) {
+	v, n := binary.Varint(d.data[d.pos:])
+	if n <= 0 {
+		if n == 0 {
+			return 0, errTruncated
+		}
+		return 0, fmt.Errorf("varint overflow at offset %d", d.pos)
+	}
+	if v > 1<<31 || v < -1<<31 {
+		return 0, fmt.Errorf("value %d out of range at offset %d", v, d.pos)
+	}
+	d.pos += n
+	return int(v), nil
+}
+
+// Decode parses bytecode into the commands of a file. name is the file name
+// without the extension and becomes the File of every position.
+func Decode(name string, data []byte) ([]vmir.Command, error) {
+	if !IsBytecode(data) {
+		return nil, fmt.Errorf("missing %q header", Magic)
+	}
+	d := &decoder{data: data, pos: len(Magic)}
+	v, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	if v < 1 || v > version {
+		return nil, fmt.Errorf("unsupported bytecode version %d", v)
+	}
+	d.version = v
+
+	count, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	var stringTable []string
+	for i := 0; i < count; i++ {
+		length, err := d.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if length > len(d.data)-d.pos {
+			return nil, errTruncated
+		}
+		stringTable = append(stringTable, string(d.data[d.pos:d.pos+length]))
+		d.pos += length
+	}
+	readString := func() (string, error) {
+		i, err := d.uvarint()
+		if err != nil {
+			return "", err
+		}
+		if i >= len(stringTable) {
+			return "", fmt.Errorf("string index %d out of range at offset %d", i, d.pos)
+		}
+		return stringTable[i], nil
+	}
+
+	count, err = d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	var commands []vmir.Command
+	line := 0
+	for i := 0; i < count; i++ {
+		offset := d.pos
+		op, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		var command vmir.Command
+		switch op {
+		case opAdd, opSub, opNeg, opEq, opGt, opLt, opAnd, opOr, opNot:
+			for symbol, opcode := range arithmeticOpcodes {
+				if opcode == op {
+					command = vmir.Command{Op: symbol}
+				}
+			}
+		case opPush, opPop:
+			segment, err := d.byte()
+			if err != nil {
+				return nil, err
+			}
+			if int(segment) >= len(segments) {
+				return nil, fmt.Errorf("unknown segment %d at offset %d", segment, offset)
+			}
+			var index int
+			if segments[segment] == vmir.Constant && d.version >= 2 {
+				index, err = d.varint()
+			} else {
+				index, err = d.uvarint()
+			}
+			if err != nil {
+				return nil, err
+			}
+			command = vmir.Command{Op: vmir.Push, Segment: segments[segment], Index: index}
+			if op == opPop {
+				command.Op = vmir.Pop
+			}
+		case opLabel, opGoto, opIf:
+			label, err := readString()
+			if err != nil {
+				return nil, err
+			}
+			command = vmir.Command{Op: map[byte]vmir.Opcode{opLabel: vmir.Label, opGoto: vmir.Goto, opIf: vmir.IfGoto}[op], Name: label}
+		case opFunc, opCall:
+			function, err := readString()
+			if err != nil {
+				return nil, err
+			}
+			n, err := d.uvarint()
+			if err != nil {
+				return nil, err
+			}
+			command = vmir.Command{Op: vmir.Function, Name: function, Index: n}
+			if op == opCall {
+				command.Op = vmir.Call
+			}
+		case opReturn:
+			command = vmir.Command{Op: vmir.Return}
+		default:
+			return nil, fmt.Errorf("unknown opcode 0x%02x at offset %d", op, offset)
+		}
+		delta, err := d.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		line += delta
+		command.Pos = vmir.Pos{File: name, Line: line}
+		commands = append(commands, command)
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("%d trailing bytes after the last command", len(d.data)-d.pos)
+	}
+	return commands, nil
+}
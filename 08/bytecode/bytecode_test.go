@@ -0,0 +1,90 @@
+package bytecode_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/youchann/nand2tetris/08/bytecode"
+	"github.com/youchann/nand2tetris/08/internal/vmtest"
+	"github.com/youchann/nand2tetris/vmir"
+)
+
+// TestRoundTrip encodes every project 7 and 8 .vm file and checks that
+// decoding gives back the same commands, and that every shorter prefix of
+// the encoding is rejected.
+func TestRoundTrip(t *testing.T) {
+	dirs, err := vmtest.Dirs(vmtest.Roots...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range dirs {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.vm"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range paths {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := strings.TrimSuffix(filepath.Base(path), ".vm")
+			commands, err := vmir.Parse(name, string(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := bytecode.Encode(commands)
+			if err != nil {
+				t.Errorf("%s: %v", path, err)
+				continue
+			}
+			decoded, err := bytecode.Decode(name, data)
+			if err != nil {
+				t.Errorf("%s: %v", path, err)
+				continue
+			}
+			if !slices.Equal(decoded, commands) {
+				t.Errorf("%s: decoded commands differ", path)
+			}
+			for n := range len(data) {
+				if _, err := bytecode.Decode(name, data[:n]); err == nil {
+					t.Errorf("%s: decoded the first %d of %d bytes", path, n, len(data))
+				}
+			}
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string // the decoded commands in .vm form, or "" for an error
+	}{
+		{"version 1", "VMBC\x01\x00\x01\x10\x06\x05\x01", "    push constant 5\n"},
+		{"version 2", "VMBC\x02\x00\x01\x10\x06\x0a\x01", "    push constant 5\n"},
+		{"negative constant", "VMBC\x02\x00\x01\x10\x06\x09\x01", "    push constant -5\n"},
+		{"labels", "VMBC\x02\x01\x04LOOP\x02\x20\x00\x01\x21\x00\x01", "label LOOP\n    goto LOOP\n"},
+		{"version 0", "VMBC\x00\x00\x00", ""},
+		{"version 3", "VMBC\x03\x00\x00", ""},
+		{"bad string index", "VMBC\x02\x01\x04LOOP\x01\x20\x01\x01", ""},
+		{"unknown segment", "VMBC\x02\x00\x01\x10\x08\x00\x01", ""},
+		{"unknown opcode", "VMBC\x02\x00\x01\xff\x01", ""},
+		{"no header", "VMB", ""},
+	}
+	for _, tt := range tests {
+		commands, err := bytecode.Decode("Main", []byte(tt.data))
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("%s: decoded %v, want an error", tt.name, commands)
+		case tt.want != "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.want != "":
+			if got := vmir.Format(commands); got != tt.want {
+				t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+			}
+		}
+	}
+}
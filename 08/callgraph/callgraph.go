@@ -0,0 +1,101 @@
+package callgraph
+
+import (
+	"github.com/youchann/nand2tetris/08/token"
+	"github.com/youchann/nand2tetris/vmir"
+)
+
+type Function struct {
+	Name string
+	File string
+	// Commands starts with the function command itself and runs up to the
+	// next function command or the end of the file.
+	Commands []token.Command
+}
+
+type Graph struct {
+	Functions []*Function // in source order
+	// Calls maps each function to the functions it calls, with one entry per
+	// call site.
+	Calls     map[string][]string
+	functions map[string]*Function
+}
+
+func New(files []token.File) *Graph {
+	g := &Graph{
+		Functions: nil,
+		Calls:     map[string][]string{},
+		functions: map[string]*Function{},
+	}
+	for _, file := range files {
+		var current *Function
+		for _, command := range file.Commands {
+			if command.Op == vmir.Function {
+				current = &Function{Name: command.Name, File: file.Name}
+				g.Functions = append(g.Functions, current)
+				g.functions[current.Name] = current
+			}
+			if current == nil {
+				continue
+			}
+			current.Commands = append(current.Commands, command)
+			if command.Op == vmir.Call {
+				g.Calls[current.Name] = append(g.Calls[current.Name], command.Name)
+			}
+		}
+	}
+	return g
+}
+
+// Function returns the function with the given name, or nil if it is not
+// defined.
+func (g *Graph) Function(name string) *Function {
+	return g.functions[name]
+}
+
+// Reachable returns the set of defined functions that can be called,
+// directly or indirectly, from root.
+func (g *Graph) Reachable(root string) map[string]bool {
+	reachable := map[string]bool{}
+	stack := []string{root}
+	for len(stack) > 0 {
+		name := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if reachable[name] || g.functions[name] == nil {
+			continue
+		}
+		reachable[name] = true
+		stack = append(stack, g.Calls[name]...)
+	}
+	return reachable
+}
+
+// EliminateDeadFunctions drops every function that is not reachable from
+// root and returns the remaining files along with the removed functions in
+// source order. Commands that precede the first function of a file are kept.
+func EliminateDeadFunctions(files []token.File, root string) ([]token.File, []*Function) {
+	g := New(files)
+	reachable := g.Reachable(root)
+	var removed []*Function
+	for _, f := range g.Functions {
+		if !reachable[f.Name] {
+			removed = append(removed, f)
+		}
+	}
+
+	var result []token.File
+	for _, file := range files {
+		kept := token.File{Name: file.Name}
+		keep := true
+		for _, command := range file.Commands {
+			if command.Op == vmir.Function {
+				keep = reachable[command.Name]
+			}
+			if keep {
+				kept.Commands = append(kept.Commands, command)
+			}
+		}
+		result = append(result, kept)
+	}
+	return result, removed
+}
@@ -0,0 +1,141 @@
+package callgraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/youchann/nand2tetris/08/token"
+	"github.com/youchann/nand2tetris/vmir"
+)
+
+// Kinds of Jack subroutines, as returned by Function.Kind.
+const (
+	KindConstructor = "constructor"
+	KindMethod      = "method"
+	KindFunction    = "function"
+)
+
+// NumLocals returns the number of locals declared by the function command.
+func (f *Function) NumLocals() int {
+	return f.Commands[0].Index
+}
+
+// Kind infers the kind of Jack subroutine f was compiled from by its
+// prologue: constructors allocate their object and set pointer 0 to it, and
+// methods set pointer 0 to argument 0.
+func (f *Function) Kind() string {
+	body := f.Commands[1:]
+	switch {
+	case len(body) >= 3 && isPush(body[0], vmir.Constant) && body[1].Op == vmir.Call && body[1].Name == "Memory.alloc" && isPop(body[2], vmir.Pointer, 0):
+		return KindConstructor
+	case len(body) >= 2 && isPush(body[0], vmir.Argument) && body[0].Index == 0 && isPop(body[1], vmir.Pointer, 0):
+		return KindMethod
+	default:
+		return KindFunction
+	}
+}
+
+func isPush(command token.Command, segment vmir.Segment) bool {
+	return command.Op == vmir.Push && command.Segment == segment
+}
+
+func isPop(command token.Command, segment vmir.Segment, index int) bool {
+	return command.Op == vmir.Pop && command.Segment == segment && command.Index == index
+}
+
+// Edge is a caller and callee pair with the number of call sites.
+type Edge struct {
+	Caller string `json:"caller"`
+	Callee string `json:"callee"`
+	Count  int    `json:"count"`
+}
+
+// Edges returns the calls of every function merged by callee, ordered by
+// caller in source order and then by the first call site.
+func (g *Graph) Edges() []Edge {
+	var edges []Edge
+	for _, f := range g.Functions {
+		index := map[string]int{}
+		for _, callee := range g.Calls[f.Name] {
+			i, ok := index[callee]
+			if !ok {
+				i = len(edges)
+				index[callee] = i
+				edges = append(edges, Edge{Caller: f.Name, Callee: callee})
+			}
+			edges[i].Count++
+		}
+	}
+	return edges
+}
+
+type jsonFunction struct {
+	Name     string `json:"name"`
+	File     string `json:"file"`
+	Kind     string `json:"kind"`
+	Locals   int    `json:"locals"`
+	Commands int    `json:"commands"`
+}
+
+// WriteJSON writes the functions, with their number of commands after the
+// function command, and the edges of g as JSON.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	graph := struct {
+		Functions []jsonFunction `json:"functions"`
+		Calls     []Edge         `json:"calls"`
+	}{Functions: []jsonFunction{}, Calls: g.Edges()}
+	for _, f := range g.Functions {
+		graph.Functions = append(graph.Functions, jsonFunction{f.Name, f.File, f.Kind(), f.NumLocals(), len(f.Commands) - 1})
+	}
+	if graph.Calls == nil {
+		graph.Calls = []Edge{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(graph)
+}
+
+// WriteDOT writes g in the Graphviz DOT language with one cluster per file.
+// Called functions that are not defined are drawn dashed.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var result []string
+	result = append(result, "digraph calls {")
+	result = append(result, "  rankdir=LR;", "  node [shape=box];")
+	var files []string
+	functions := map[string][]*Function{}
+	for _, f := range g.Functions {
+		if functions[f.File] == nil {
+			files = append(files, f.File)
+		}
+		functions[f.File] = append(functions[f.File], f)
+	}
+	for i, file := range files {
+		result = append(result, fmt.Sprintf("  subgraph cluster_%d {", i), "    label="+quote(file+".vm")+";")
+		for _, f := range functions[file] {
+			label := fmt.Sprintf("%s\\n%s, %d locals, %d commands", f.Name, f.Kind(), f.NumLocals(), len(f.Commands)-1)
+			result = append(result, "    "+quote(f.Name)+" [label="+quote(label)+"];")
+		}
+		result = append(result, "  }")
+	}
+	edges := g.Edges()
+	undefined := map[string]bool{}
+	for _, e := range edges {
+		if g.Function(e.Callee) == nil && !undefined[e.Callee] {
+			undefined[e.Callee] = true
+			result = append(result, "  "+quote(e.Callee)+" [style=dashed];")
+		}
+	}
+	for _, e := range edges {
+		result = append(result, fmt.Sprintf("  %s -> %s [label=%d];", quote(e.Caller), quote(e.Callee), e.Count))
+	}
+	result = append(result, "}")
+	_, err := io.WriteString(w, strings.Join(result, "\n")+"\n")
+	return err
+}
+
+// quote returns s as a DOT string. The \n escape in labels is kept.
+func quote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
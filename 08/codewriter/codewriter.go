@@ -1,146 +1,717 @@
 package codewriter
 
 import (
-	"os"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
 	"strconv"
 	"strings"
 
 	"github.com/youchann/nand2tetris/08/token"
+	"github.com/youchann/nand2tetris/vmir"
 )
 
+type Options struct {
+	// SharedRoutines makes call, return and comparison commands jump into a
+	// single global routine instead of inlining the whole sequence each time.
+	SharedRoutines bool
+	// Annotate writes each VM command as a comment before its assembly and
+	// records a source map entry for it.
+	Annotate bool
+	// StackCheck traps at run time when the stack grows past the layout's
+	// stack limit or a command pops below the current frame. Without it no
+	// checking code is emitted at all.
+	StackCheck bool
+	Layout     Layout
+}
+
+// StaticVariable is a static variable together with the RAM address it
+// occupies in the translated program.
+type StaticVariable struct {
+	File    string
+	Index   int
+	Address int
+}
+
+// Layout describes where the translated program keeps its stack and fixed
+// segments, and how it starts.
+type Layout struct {
+	StackBase int    // initial value of SP
+	Bootstrap bool   // whether to set SP and call Entry before anything else
+	Entry     string // function called by the bootstrap
+	TempBase  int    // address of temp 0
+	// StackLimit is the highest value SP may reach when StackCheck is on.
+	StackLimit int
+	// StaticBase is the address of the first static variable. Zero leaves
+	// the allocation to the assembler, which starts at RAM 16.
+	StaticBase int
+}
+
+// DefaultLayout returns the standard Hack layout with a bootstrap that calls
+// Sys.init.
+func DefaultLayout() Layout {
+	return Layout{
+		StackBase:  256,
+		Bootstrap:  true,
+		Entry:      "Sys.init",
+		TempBase:   5,
+		StackLimit: 2048,
+		StaticBase: 0,
+	}
+}
+
+// SourceMapEntry ties the assembly generated for one VM command back to the
+// command it came from.
+type SourceMapEntry struct {
+	AsmLine    int    `json:"asmLine"`    // 1-based line of the first instruction in the .asm file
+	ROMAddress int    `json:"romAddress"` // address of that instruction after assembly
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	Function   string `json:"function"`
+	Command    string `json:"command"`
+}
+
 type CodeWriter struct {
-	filename     string
-	assembly     []string
-	compareCount int
-	callCount    int
+	writer         *bufio.Writer
+	filename       string
+	function       string
+	lineCount      int
+	romSize        int
+	compareCount   map[string]int // per file, see uniqueLabel
+	callCount      map[string]int // per file, see uniqueLabel
+	sharedRoutines bool
+	usedRoutines   map[string]bool
+	annotate       bool
+	sourceMap      []SourceMapEntry
+	layout         Layout
+	staticAddress  map[string]int
+	statics        []StaticVariable
+	stackCheck     bool
+	numLocals      int
+	trapFunctions  []string
+	inlineFrames   []inlineFrame
+	// A fragment writes into buffer and numbers its statics and functions
+	// after those of the files before it, see Fragment.
+	buffer         *bytes.Buffer
+	staticOffset   int
+	functionOffset int
 }
 
-func New() *CodeWriter {
+// New returns a CodeWriter that streams assembly to w as commands are
+// written. Nothing is guaranteed to reach w until Close is called.
+func New(w io.Writer, opts Options) (*CodeWriter, error) {
 	c := &CodeWriter{
-		filename:     "",
-		assembly:     nil,
-		compareCount: 0,
-		callCount:    0,
+		writer:         bufio.NewWriter(w),
+		filename:       "",
+		function:       "",
+		lineCount:      0,
+		romSize:        0,
+		compareCount:   map[string]int{},
+		callCount:      map[string]int{},
+		sharedRoutines: opts.SharedRoutines,
+		usedRoutines:   map[string]bool{},
+		annotate:       opts.Annotate,
+		sourceMap:      nil,
+		layout:         opts.Layout,
+		staticAddress:  map[string]int{},
+		statics:        nil,
+		stackCheck:     opts.StackCheck,
+		numLocals:      0,
+		trapFunctions:  nil,
+		inlineFrames:   nil,
+		buffer:         nil,
+		staticOffset:   0,
+		functionOffset: 0,
+	}
+	if err := validateLayout(opts.Layout); err != nil {
+		return nil, err
+	}
+	if opts.StackCheck && opts.Layout.TrapCodeAddress() < 16 {
+		return nil, fmt.Errorf("stack base %d leaves no room for the trap words below it", opts.Layout.StackBase)
 	}
-	c.setInitAssembly()
-	return c
+	if err := c.writeInitAssembly(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func validateLayout(layout Layout) error {
+	if layout.StackBase < 16 || layout.StackBase > 16383 {
+		return fmt.Errorf("stack base %d is outside RAM 16-16383", layout.StackBase)
+	}
+	if layout.TempBase < 0 || layout.TempBase+7 > 16383 {
+		return fmt.Errorf("temp base %d is outside RAM 0-16376", layout.TempBase)
+	}
+	if layout.StaticBase < 0 || layout.StaticBase > 16383 {
+		return fmt.Errorf("static base %d is outside RAM 0-16383", layout.StaticBase)
+	}
+	if layout.StackLimit <= layout.StackBase {
+		return fmt.Errorf("stack limit %d must be above the stack base %d", layout.StackLimit, layout.StackBase)
+	}
+	if layout.Bootstrap && layout.Entry == "" {
+		return fmt.Errorf("bootstrap requires an entry function")
+	}
+	return nil
 }
 
-func (c *CodeWriter) setInitAssembly() {
-	c.assembly = []string{"@256", "D=A", "@SP", "M=D"} // SP = 256
-	c.WriteCall("Sys.init", 0)                         // call Sys.init
+func (c *CodeWriter) writeInitAssembly() error {
+	if !c.layout.Bootstrap {
+		return nil
+	}
+	if err := c.write([]string{"@" + strconv.Itoa(c.layout.StackBase), "D=A", "@SP", "M=D"}); err != nil { // SP = StackBase
+		return err
+	}
+	return c.WriteCall(c.layout.Entry, 0) // call Entry
 }
 
 func (c *CodeWriter) Setfilename(filename string) {
 	c.filename = filename
 }
 
-func (c *CodeWriter) WriteArithmetic(command token.CommandSymbol) {
+// WriteSource tells the CodeWriter which command the following Write* call
+// translates. With Annotate enabled it writes the command as a comment and
+// adds a source map entry.
+func (c *CodeWriter) WriteSource(command token.Command) error {
+	if !c.annotate {
+		return nil
+	}
+	function := c.function
+	if command.Op == vmir.Function {
+		function = command.Name
+	}
+	parts := command.Parts
+	if len(parts) == 0 || command.Op == token.INLINE {
+		parts = []token.Command{command}
+	}
+	var comments []string
+	for _, part := range parts {
+		comments = append(comments, "// "+c.filename+".vm:"+strconv.Itoa(part.Pos.Line)+" "+part.String())
+	}
+	if err := c.write(comments); err != nil {
+		return err
+	}
+	c.sourceMap = append(c.sourceMap, SourceMapEntry{
+		AsmLine:    c.lineCount + 1,
+		ROMAddress: c.romSize,
+		File:       c.filename + ".vm",
+		Line:       parts[0].Pos.Line,
+		Function:   function,
+		Command:    command.String(),
+	})
+	return nil
+}
+
+// SourceMap returns the entries recorded by WriteSource in output order.
+func (c *CodeWriter) SourceMap() []SourceMapEntry {
+	return c.sourceMap
+}
+
+func (c *CodeWriter) WriteArithmetic(command token.CommandSymbol) error {
+	var assembly []string
+	operands := 2
 	switch command {
 	case token.ADD:
-		c.assembly = append(c.assembly, generateAdd()...)
+		assembly = generateAdd()
 	case token.SUB:
-		c.assembly = append(c.assembly, generateSUB()...)
+		assembly = generateSUB()
 	case token.NEG:
-		c.assembly = append(c.assembly, generateNEG()...)
+		assembly = generateNEG()
+		operands = 1
 	case token.EQ, token.LT, token.GT:
-		c.assembly = append(c.assembly, generateCompare(command, c.compareCount)...)
-		c.compareCount++
+		count := c.compareCount[c.filename]
+		if c.sharedRoutines {
+			c.usedRoutines[string(command)] = true
+			assembly = generateCompareCall(command, c.uniqueLabel(string(command)+".ret", count))
+		} else {
+			assembly = generateCompare(command, c.uniqueLabel("true", count), c.uniqueLabel("end", count))
+		}
+		c.compareCount[c.filename]++
 	case token.AND:
-		c.assembly = append(c.assembly, generateAND()...)
+		assembly = generateAND()
 	case token.OR:
-		c.assembly = append(c.assembly, generateOR()...)
+		assembly = generateOR()
 	case token.NOT:
-		c.assembly = append(c.assembly, generateNOT()...)
+		assembly = generateNOT()
+		operands = 1
+	default:
+		return fmt.Errorf("unsupported arithmetic command %q", command)
 	}
+	return c.writeChecked(operands, false, assembly)
 }
 
-func (c *CodeWriter) WritePushPop(command token.CommandType, segment token.Segment, index int) {
+func (c *CodeWriter) WritePushPop(command token.CommandType, segment token.Segment, index int) error {
+	if err := checkIndex(segment, index); err != nil {
+		return err
+	}
 	switch command {
 	case token.C_PUSH:
-		c.assembly = append(c.assembly, generatePush(segment, index, c.filename)...)
+		assembly, err := c.generatePush(segment, index)
+		if err != nil {
+			return err
+		}
+		return c.writeChecked(0, true, assembly)
 	case token.C_POP:
-		c.assembly = append(c.assembly, generatePop(segment, index, c.filename)...)
+		assembly, err := c.generatePop(segment, index)
+		if err != nil {
+			return err
+		}
+		return c.writeChecked(1, false, assembly)
 	default:
+		return fmt.Errorf("unsupported command %q, expected push or pop", command)
+	}
+}
+
+// WriteMove writes a push immediately followed by a pop as a direct
+// memory-to-memory move that never touches the stack.
+func (c *CodeWriter) WriteMove(srcSegment token.Segment, srcIndex int, dstSegment token.Segment, dstIndex int) error {
+	if err := checkIndex(srcSegment, srcIndex); err != nil {
+		return err
+	}
+	if err := checkIndex(dstSegment, dstIndex); err != nil {
+		return err
 	}
+	assembly, err := c.generateMove(srcSegment, srcIndex, dstSegment, dstIndex)
+	if err != nil {
+		return err
+	}
+	return c.write(assembly)
+}
+
+func (c *CodeWriter) WritePushTrue() error {
+	var assembly []string
+	assembly = append(assembly, "@SP", "A=M", "M=-1") // RAM[SP] = -1
+	assembly = append(assembly, "@SP", "M=M+1")       // SP++
+	return c.writeChecked(0, true, assembly)
+}
+
+// WriteIfNot writes a not followed by an if-goto.
+func (c *CodeWriter) WriteIfNot(label string) error {
+	var assembly []string
+	assembly = append(assembly, "@SP", "AM=M-1", "D=M+1")          // D = RAM[SP-1] + 1
+	assembly = append(assembly, "@"+c.scopedLabel(label), "D;JNE") // if RAM[SP-1] != -1, jump to label
+	return c.writeChecked(1, false, assembly)
 }
 
-func (c *CodeWriter) WriteLabel(label string) {
-	c.assembly = append(c.assembly, "("+label+")")
+// WriteCompareIf writes a comparison followed by an if-goto, optionally with
+// a not in between, as a single conditional jump.
+func (c *CodeWriter) WriteCompareIf(command token.CommandSymbol, label string, negate bool) error {
+	assembly, err := generateCompareIf(command, c.scopedLabel(label), negate)
+	if err != nil {
+		return err
+	}
+	return c.writeChecked(2, false, assembly)
 }
 
-func (c *CodeWriter) WriteGoto(label string) {
-	c.assembly = append(c.assembly, "@"+label, "0;JMP")
+func (c *CodeWriter) WriteLabel(label string) error {
+	return c.write([]string{"(" + c.scopedLabel(label) + ")"})
 }
 
-func (c *CodeWriter) WriteIf(label string) {
-	c.assembly = append(c.assembly, "@SP", "AM=M-1", "D=M") // move RAM[SP-1] to D
-	c.assembly = append(c.assembly, "@"+label, "D;JNE")     // if D != 0, jump to label
+func (c *CodeWriter) WriteGoto(label string) error {
+	return c.write([]string{"@" + c.scopedLabel(label), "0;JMP"})
 }
 
-func (c *CodeWriter) WriteFunction(functionName string, numLocals int) {
-	c.assembly = append(c.assembly, "("+functionName+")")
+func (c *CodeWriter) WriteIf(label string) error {
+	var assembly []string
+	assembly = append(assembly, "@SP", "AM=M-1", "D=M")            // move RAM[SP-1] to D
+	assembly = append(assembly, "@"+c.scopedLabel(label), "D;JNE") // if D != 0, jump to label
+	return c.writeChecked(1, false, assembly)
+}
+
+func (c *CodeWriter) WriteFunction(functionName string, numLocals int) error {
+	c.function = functionName
+	c.numLocals = numLocals
+	c.enterCheckedFunction(functionName)
+	assembly := []string{"(" + functionName + ")"}
 	for i := 0; i < numLocals; i++ {
-		c.assembly = append(c.assembly, "@SP", "A=M", "M=0", "@SP", "M=M+1") // push 0
+		assembly = append(assembly, "@SP", "A=M", "M=0", "@SP", "M=M+1") // push 0
+	}
+	return c.writeChecked(0, true, assembly) // the caller's frame and the locals are now on the stack
+}
+
+func (c *CodeWriter) WriteReturn() error {
+	if c.sharedRoutines {
+		c.usedRoutines["return"] = true
+		return c.writeChecked(1, false, []string{"@$$return", "0;JMP"}) // goto shared return routine
+	}
+	return c.writeChecked(1, false, generateReturn())
+}
+
+func (c *CodeWriter) WriteCall(functionName string, numArgs int) error {
+	returnAddress := c.uniqueLabel("ret", c.callCount[c.filename])
+	c.callCount[c.filename]++
+
+	var assembly []string
+	if c.stackCheck {
+		// The frame must fit before the jump. Then there is also room for
+		// the return value after the callee returns.
+		assembly = c.generateOverflowCheck(callFrameSize)
+	}
+	if c.sharedRoutines {
+		c.usedRoutines["call"] = true
+		assembly = append(assembly, generateCallSharedRoutine(functionName, numArgs, returnAddress)...)
+	} else {
+		assembly = append(assembly, generateCall(functionName, numArgs, returnAddress)...)
+	}
+	return c.writeChecked(numArgs, false, assembly)
+}
+
+// uniqueLabel returns the count-th label of the given kind in the current
+// file. Counting per file keeps the labels of a file independent of the
+// other files, and "$$" cannot occur in a scoped VM label.
+func (c *CodeWriter) uniqueLabel(kind string, count int) string {
+	return c.filename + "$$" + kind + "." + strconv.Itoa(count)
+}
+
+// scopedLabel qualifies label with the enclosing function so that the same
+// label can be used in different functions. Labels outside any function are
+// left as they are.
+func (c *CodeWriter) scopedLabel(label string) string {
+	if c.function == "" {
+		return label
+	}
+	return c.function + "$" + label
+}
+
+// ROMCapacity is the number of instructions the Hack ROM holds.
+const ROMCapacity = 32768
+
+// MinConstant and MaxConstant bound the literals of push constant: any
+// signed or unsigned 16-bit value.
+const (
+	MinConstant = -32768
+	MaxConstant = 65535
+)
+
+// ROMSize returns the number of instructions written so far. After Close it
+// includes the shared routines.
+func (c *CodeWriter) ROMSize() int {
+	return c.romSize
+}
+
+// Close writes the shared routines that have been used and flushes the
+// remaining assembly to the underlying writer.
+func (c *CodeWriter) Close() error {
+	if err := c.write(c.generateSharedRoutines()); err != nil {
+		return err
+	}
+	return c.writer.Flush()
+}
+
+func (c *CodeWriter) write(assembly []string) error {
+	for _, line := range assembly {
+		if !strings.HasPrefix(line, "(") && !strings.HasPrefix(line, "//") {
+			c.romSize++
+		}
+		c.lineCount++
+		if _, err := c.writer.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func generateCall(functionName string, numArgs int, returnAddress string) []string {
+	var result []string
+	result = append(result, "@"+returnAddress, "D=A", "@SP", "A=M", "M=D", "@SP", "M=M+1")                                               // push return address
+	result = append(result, "@LCL", "D=M", "@SP", "A=M", "M=D", "@SP", "M=M+1")                                                          // push LCL
+	result = append(result, "@ARG", "D=M", "@SP", "A=M", "M=D", "@SP", "M=M+1")                                                          // push ARG
+	result = append(result, "@THIS", "D=M", "@SP", "A=M", "M=D", "@SP", "M=M+1")                                                         // push THIS
+	result = append(result, "@THAT", "D=M", "@SP", "A=M", "M=D", "@SP", "M=M+1")                                                         // push THAT
+	result = append(result, "@SP", "D=M", "@5", "D=D-A", "@"+strconv.Itoa(numArgs), "D=D-A", "@ARG", "M=D", "@SP", "D=M", "@LCL", "M=D") // ARG = SP - 5 - numArgs, LCL = SP
+	result = append(result, "@"+functionName, "0;JMP")                                                                                   // goto functionName
+	result = append(result, "("+returnAddress+")")                                                                                       // (returnAddress)
+	return result
+}
+
+func generateCallSharedRoutine(functionName string, numArgs int, returnAddress string) []string {
+	var result []string
+	result = append(result, "@"+returnAddress, "D=A", "@R13", "M=D")   // R13 = return address
+	result = append(result, "@"+functionName, "D=A", "@R14", "M=D")    // R14 = functionName
+	result = append(result, "@"+strconv.Itoa(numArgs), "D=A")          // D = numArgs
+	result = append(result, "@$$call", "0;JMP", "("+returnAddress+")") // goto shared call routine
+	return result
+}
+
+func generateReturn() []string {
+	var result []string
+	result = append(result, "@LCL", "D=M", "@R13", "M=D")                 // R13 = LCL
+	result = append(result, "@5", "A=D-A", "D=M", "@R14", "M=D")          // R14 = *(LCL-5)
+	result = append(result, "@SP", "AM=M-1", "D=M", "@ARG", "A=M", "M=D") // *ARG = pop()
+	result = append(result, "@ARG", "D=M+1", "@SP", "M=D")                // SP = ARG + 1
+	result = append(result, "@R13", "AM=M-1", "D=M", "@THAT", "M=D")      // THAT = *(LCL-1)
+	result = append(result, "@R13", "AM=M-1", "D=M", "@THIS", "M=D")      // THIS = *(LCL-2)
+	result = append(result, "@R13", "AM=M-1", "D=M", "@ARG", "M=D")       // ARG = *(LCL-3)
+	result = append(result, "@R13", "AM=M-1", "D=M", "@LCL", "M=D")       // LCL = *(LCL-4)
+	result = append(result, "@R14", "A=M", "0;JMP")                       // goto return address
+	return result
+}
+
+func (c *CodeWriter) generateSharedRoutines() []string {
+	if len(c.usedRoutines) == 0 {
+		return nil
 	}
+	var result []string
+	result = append(result, "($$halt)", "@$$halt", "0;JMP") // never fall through into the routines
+	if c.usedRoutines["call"] {
+		result = append(result, generateCallRoutine()...)
+	}
+	if c.usedRoutines["return"] {
+		result = append(result, generateReturnRoutine()...)
+	}
+	for _, command := range []token.CommandSymbol{token.EQ, token.GT, token.LT} {
+		if c.usedRoutines[string(command)] {
+			result = append(result, generateCompareRoutine(command)...)
+		}
+	}
+	if c.usedRoutines["trap"] {
+		result = append(result, c.generateTrapRoutines()...)
+	}
+	return result
 }
 
-func (c *CodeWriter) WriteReturn() {
-	c.assembly = append(c.assembly, "@LCL", "D=M", "@R13", "M=D")                 // R13 = LCL
-	c.assembly = append(c.assembly, "@5", "A=D-A", "D=M", "@R14", "M=D")          // R14 = *(LCL-5)
-	c.assembly = append(c.assembly, "@SP", "AM=M-1", "D=M", "@ARG", "A=M", "M=D") // *ARG = pop()
-	c.assembly = append(c.assembly, "@ARG", "D=M+1", "@SP", "M=D")                // SP = ARG + 1
-	c.assembly = append(c.assembly, "@R13", "AM=M-1", "D=M", "@THAT", "M=D")      // THAT = *(LCL-1)
-	c.assembly = append(c.assembly, "@R13", "AM=M-1", "D=M", "@THIS", "M=D")      // THIS = *(LCL-2)
-	c.assembly = append(c.assembly, "@R13", "AM=M-1", "D=M", "@ARG", "M=D")       // ARG = *(LCL-3)
-	c.assembly = append(c.assembly, "@R13", "AM=M-1", "D=M", "@LCL", "M=D")       // LCL = *(LCL-4)
-	c.assembly = append(c.assembly, "@R14", "A=M", "0;JMP")                       // goto return address
+// generateCallRoutine expects the return address in R13, the callee address
+// in R14 and the number of arguments in D.
+func generateCallRoutine() []string {
+	var result []string
+	result = append(result, "($$call)", "@R15", "M=D")                                   // R15 = numArgs
+	result = append(result, "@R13", "D=M", "@SP", "A=M", "M=D", "@SP", "M=M+1")          // push return address
+	result = append(result, "@LCL", "D=M", "@SP", "A=M", "M=D", "@SP", "M=M+1")          // push LCL
+	result = append(result, "@ARG", "D=M", "@SP", "A=M", "M=D", "@SP", "M=M+1")          // push ARG
+	result = append(result, "@THIS", "D=M", "@SP", "A=M", "M=D", "@SP", "M=M+1")         // push THIS
+	result = append(result, "@THAT", "D=M", "@SP", "A=M", "M=D", "@SP", "M=M+1")         // push THAT
+	result = append(result, "@R15", "D=M", "@5", "D=D+A", "@SP", "D=M-D", "@ARG", "M=D") // ARG = SP - 5 - numArgs
+	result = append(result, "@SP", "D=M", "@LCL", "M=D")                                 // LCL = SP
+	result = append(result, "@R14", "A=M", "0;JMP")                                      // goto functionName
+	return result
 }
 
-func (c *CodeWriter) WriteCall(functionName string, numArgs int) {
-	returnAddress := functionName + "$ret." + strconv.Itoa(c.callCount)
-	c.callCount++
+func generateReturnRoutine() []string {
+	var result []string
+	result = append(result, "($$return)", "@LCL", "D=M", "@R13", "M=D")   // R13 = LCL
+	result = append(result, "@5", "A=D-A", "D=M", "@R14", "M=D")          // R14 = *(LCL-5)
+	result = append(result, "@SP", "AM=M-1", "D=M", "@ARG", "A=M", "M=D") // *ARG = pop()
+	result = append(result, "@ARG", "D=M+1", "@SP", "M=D")                // SP = ARG + 1
+	result = append(result, "@R13", "AM=M-1", "D=M", "@THAT", "M=D")      // THAT = *(LCL-1)
+	result = append(result, "@R13", "AM=M-1", "D=M", "@THIS", "M=D")      // THIS = *(LCL-2)
+	result = append(result, "@R13", "AM=M-1", "D=M", "@ARG", "M=D")       // ARG = *(LCL-3)
+	result = append(result, "@R13", "AM=M-1", "D=M", "@LCL", "M=D")       // LCL = *(LCL-4)
+	result = append(result, "@R14", "A=M", "0;JMP")                       // goto return address
+	return result
+}
 
-	c.assembly = append(c.assembly, "@"+returnAddress, "D=A", "@SP", "A=M", "M=D", "@SP", "M=M+1")                                               // push return address
-	c.assembly = append(c.assembly, "@LCL", "D=M", "@SP", "A=M", "M=D", "@SP", "M=M+1")                                                          // push LCL
-	c.assembly = append(c.assembly, "@ARG", "D=M", "@SP", "A=M", "M=D", "@SP", "M=M+1")                                                          // push ARG
-	c.assembly = append(c.assembly, "@THIS", "D=M", "@SP", "A=M", "M=D", "@SP", "M=M+1")                                                         // push THIS
-	c.assembly = append(c.assembly, "@THAT", "D=M", "@SP", "A=M", "M=D", "@SP", "M=M+1")                                                         // push THAT
-	c.assembly = append(c.assembly, "@SP", "D=M", "@5", "D=D-A", "@"+strconv.Itoa(numArgs), "D=D-A", "@ARG", "M=D", "@SP", "D=M", "@LCL", "M=D") // ARG = SP - 5 - numArgs, LCL = SP
-	c.assembly = append(c.assembly, "@"+functionName, "0;JMP")                                                                                   // goto functionName
-	c.assembly = append(c.assembly, "("+returnAddress+")")                                                                                       // (returnAddress)
+// generateCompareRoutine expects the return address in D.
+func generateCompareRoutine(command token.CommandSymbol) []string {
+	name := "$$" + string(command)
+	var jump string
+	switch command {
+	case token.EQ:
+		jump = "JEQ" // D == 0
+	case token.LT:
+		jump = "JLT" // D < 0
+	case token.GT:
+		jump = "JGT" // D > 0
+	}
+	var result []string
+	result = append(result, "("+name+")", "@R13", "M=D")              // R13 = return address
+	result = append(result, "@SP", "AM=M-1", "D=M")                   // move RAM[SP-1] to D
+	result = append(result, "A=A-1", "D=M-D", "M=-1")                 // D = RAM[SP-2] - RAM[SP-1], assume true
+	result = append(result, "@"+name+".end", "D;"+jump)               // if <jump>, keep true
+	result = append(result, "@SP", "A=M-1", "M=0")                    // set RAM[SP-2] to 0 (false)
+	result = append(result, "("+name+".end)", "@R13", "A=M", "0;JMP") // goto return address
+	return result
 }
 
-func (c *CodeWriter) Close(filename string) {
-	err := os.WriteFile(filename, []byte(strings.Join(c.assembly, "\n")), 0644)
+func (c *CodeWriter) generateMove(srcSegment token.Segment, srcIndex int, dstSegment token.Segment, dstIndex int) ([]string, error) {
+	load, err := c.generateLoad(srcSegment, srcIndex)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	var result []string
+	switch dstSegment {
+	case token.SEGMENT_LOCAL, token.SEGMENT_ARGUMENT, token.SEGMENT_THIS, token.SEGMENT_THAT:
+		if dstIndex > 2 {
+			result = append(result, "@"+strconv.Itoa(dstIndex), "D=A")       // D = index
+			result = append(result, "@"+segmentAddress(dstSegment), "D=D+M") // D = index + segmentAddr
+			result = append(result, "@R13", "M=D")                           // R13 = D (temporarily store the address to move to)
+			result = append(result, load...)                                 // D = source
+			result = append(result, "@R13", "A=M", "M=D")                    // RAM[R13] = D
+			return result, nil
+		}
+		result = append(result, load...)                               // D = source
+		result = append(result, "@"+segmentAddress(dstSegment), "A=M") // A = segmentAddr
+		for i := 0; i < dstIndex; i++ {
+			result = append(result, "A=A+1")
+		}
+		result = append(result, "M=D") // RAM[segmentAddr + index] = D
+	case token.SEGMENT_POINTER, token.SEGMENT_STATIC, token.SEGMENT_TEMP:
+		result = append(result, load...) // D = source
+		result = append(result, "@"+c.fixedAddress(dstSegment, dstIndex), "M=D")
+	default:
+		return nil, fmt.Errorf("unsupported segment %q for pop", dstSegment)
 	}
+	return result, nil
 }
 
-func generatePush(segment token.Segment, index int, filename string) []string {
+// generateLoad loads the value of segment[index] into D.
+func (c *CodeWriter) generateLoad(segment token.Segment, index int) ([]string, error) {
+	switch segment {
+	case token.SEGMENT_CONSTANT:
+		return generateConstant(index)
+	case token.SEGMENT_LOCAL, token.SEGMENT_ARGUMENT, token.SEGMENT_THIS, token.SEGMENT_THAT:
+		switch index {
+		case 0:
+			return []string{"@" + segmentAddress(segment), "A=M", "D=M"}, nil
+		case 1:
+			return []string{"@" + segmentAddress(segment), "A=M+1", "D=M"}, nil
+		default:
+			return []string{"@" + strconv.Itoa(index), "D=A", "@" + segmentAddress(segment), "A=D+M", "D=M"}, nil
+		}
+	case token.SEGMENT_POINTER, token.SEGMENT_STATIC, token.SEGMENT_TEMP:
+		return []string{"@" + c.fixedAddress(segment, index), "D=M"}, nil
+	default:
+		return nil, fmt.Errorf("unsupported segment %q for push", segment)
+	}
+}
+
+func segmentAddress(segment token.Segment) string {
+	switch segment {
+	case token.SEGMENT_LOCAL:
+		return "LCL"
+	case token.SEGMENT_ARGUMENT:
+		return "ARG"
+	case token.SEGMENT_THIS:
+		return "THIS"
+	case token.SEGMENT_THAT:
+		return "THAT"
+	default:
+		return ""
+	}
+}
+
+// checkIndex reports an error if index lies outside segment. Constants are
+// checked by generateConstant.
+func checkIndex(segment token.Segment, index int) error {
+	switch {
+	case segment == token.SEGMENT_CONSTANT:
+		return nil
+	case index < 0,
+		segment == token.SEGMENT_POINTER && index > 1,
+		segment == token.SEGMENT_TEMP && index > 7:
+		return fmt.Errorf("%s index %d out of range", segment, index)
+	}
+	return nil
+}
+
+// fixedAddress returns the symbol of a segment entry whose address is known
+// at translation time.
+func (c *CodeWriter) fixedAddress(segment token.Segment, index int) string {
+	switch segment {
+	case token.SEGMENT_POINTER:
+		if index == 0 {
+			return "THIS"
+		}
+		return "THAT"
+	case token.SEGMENT_STATIC:
+		return c.staticSymbol(index)
+	case token.SEGMENT_TEMP:
+		return strconv.Itoa(c.layout.TempBase + index)
+	default:
+		return ""
+	}
+}
+
+// staticSymbol returns the assembler symbol of static index in the current
+// file, or its address when the layout fixes the static base.
+func (c *CodeWriter) staticSymbol(index int) string {
+	symbol := c.filename + "." + strconv.Itoa(index)
+	address, ok := c.staticAddress[symbol]
+	if !ok {
+		address = c.staticBase() + c.staticOffset + len(c.statics)
+		c.staticAddress[symbol] = address
+		c.statics = append(c.statics, StaticVariable{File: c.filename, Index: index, Address: address})
+	}
+	if c.layout.StaticBase == 0 {
+		return symbol
+	}
+	return strconv.Itoa(address)
+}
+
+func (c *CodeWriter) staticBase() int {
+	if c.layout.StaticBase == 0 {
+		return 16 // first address the assembler gives to variables
+	}
+	return c.layout.StaticBase
+}
+
+// Statics returns the static variables used so far in order of first use.
+// When the assembler allocates them, the addresses assume that it does so in
+// order of first appearance and that the program has no other variables.
+func (c *CodeWriter) Statics() []StaticVariable {
+	return c.statics
+}
+
+// CheckStatics reports an error if any static variable lies in the stack,
+// which starts at the layout's stack base, or in the trap words below it
+// when StackCheck is on.
+func (c *CodeWriter) CheckStatics() error {
+	for _, v := range c.statics {
+		if v.Address >= c.layout.StackBase {
+			return fmt.Errorf("static %d of %s is at RAM %d, which overlaps the stack starting at %d", v.Index, v.File, v.Address, c.layout.StackBase)
+		}
+		if c.stackCheck && v.Address >= c.layout.TrapCodeAddress() {
+			return fmt.Errorf("static %d of %s is at RAM %d, which overlaps the trap words at %d-%d", v.Index, v.File, v.Address, c.layout.TrapCodeAddress(), c.layout.TrapFunctionAddress())
+		}
+	}
+	return nil
+}
+
+func (c *CodeWriter) generatePush(segment token.Segment, index int) ([]string, error) {
 	switch segment {
 	case token.SEGMENT_CONSTANT:
 		return generatePushConstant(index)
 	case token.SEGMENT_LOCAL, token.SEGMENT_ARGUMENT, token.SEGMENT_THIS, token.SEGMENT_THAT:
-		return generatePushMemoryAccess(segment, index)
+		return generatePushMemoryAccess(segment, index), nil
 	case token.SEGMENT_POINTER:
-		return generatePushPointer(index)
+		return generatePushPointer(index), nil
 	case token.SEGMENT_STATIC:
-		return generatePushStatic(index, filename)
+		return generatePushStatic(c.staticSymbol(index)), nil
 	case token.SEGMENT_TEMP:
-		return generatePushTemp(index)
+		return generatePushTemp(c.layout.TempBase, index), nil
 	default:
-		return nil
+		return nil, fmt.Errorf("unsupported segment %q for push", segment)
 	}
 }
 
-func generatePushConstant(index int) []string {
+func generatePushConstant(index int) ([]string, error) {
+	load, err := generateConstant(index)
+	if err != nil {
+		return nil, err
+	}
 	var result []string
-	result = append(result, "@"+strconv.Itoa(index), "D=A") // D = index
-	result = append(result, "@SP", "A=M", "M=D")            // RAM[SP] = D
-	result = append(result, "@SP", "M=M+1")                 // SP++
-	return result
+	result = append(result, load...)             // D = index
+	result = append(result, "@SP", "A=M", "M=D") // RAM[SP] = D
+	result = append(result, "@SP", "M=M+1")      // SP++
+	return result, nil
+}
+
+// generateConstant loads a 16-bit literal into D. Values from 32768 to 65535
+// are the two's complement of a negative value. An A-instruction only holds
+// 0 to 32767, so a negative value is loaded by negating its absolute value,
+// and -32768, whose absolute value does not fit either, as !32767.
+func generateConstant(value int) ([]string, error) {
+	if value < MinConstant || value > MaxConstant {
+		return nil, fmt.Errorf("constant %d out of 16-bit range [%d, %d]", value, MinConstant, MaxConstant)
+	}
+	value = int(int16(value))
+	switch {
+	case value >= 0:
+		return []string{"@" + strconv.Itoa(value), "D=A"}, nil
+	case value == -32768:
+		return []string{"@32767", "D=!A"}, nil
+	default:
+		return []string{"@" + strconv.Itoa(-value), "D=-A"}, nil
+	}
 }
 
 func generatePushMemoryAccess(segment token.Segment, index int) []string {
@@ -177,35 +748,35 @@ func generatePushPointer(index int) []string {
 	return result
 }
 
-func generatePushStatic(index int, filename string) []string {
+func generatePushStatic(symbol string) []string {
 	var result []string
-	result = append(result, "@"+filename+"."+strconv.Itoa(index), "D=M") // D = filename.index
-	result = append(result, "@SP", "A=M", "M=D")                         // RAM[SP] = D
-	result = append(result, "@SP", "M=M+1")                              // SP++
+	result = append(result, "@"+symbol, "D=M")   // D = filename.index
+	result = append(result, "@SP", "A=M", "M=D") // RAM[SP] = D
+	result = append(result, "@SP", "M=M+1")      // SP++
 	return result
 }
 
-func generatePushTemp(index int) []string {
+func generatePushTemp(tempBase, index int) []string {
 	var result []string
-	result = append(result, "@R5", "D=A")                            // D = 5
-	result = append(result, "@"+strconv.Itoa(index), "A=D+A", "D=M") // D = RAM[5 + index]
+	result = append(result, "@"+strconv.Itoa(tempBase), "D=A")       // D = tempBase
+	result = append(result, "@"+strconv.Itoa(index), "A=D+A", "D=M") // D = RAM[tempBase + index]
 	result = append(result, "@SP", "A=M", "M=D")                     // RAM[SP] = D
 	result = append(result, "@SP", "M=M+1")                          // SP++
 	return result
 }
 
-func generatePop(segment token.Segment, index int, filename string) []string {
+func (c *CodeWriter) generatePop(segment token.Segment, index int) ([]string, error) {
 	switch segment {
 	case token.SEGMENT_LOCAL, token.SEGMENT_ARGUMENT, token.SEGMENT_THIS, token.SEGMENT_THAT:
-		return generatePopMemoryAccess(segment, index)
+		return generatePopMemoryAccess(segment, index), nil
 	case token.SEGMENT_POINTER:
-		return generatePopPointer(index)
+		return generatePopPointer(index), nil
 	case token.SEGMENT_STATIC:
-		return generatePopStatic(index, filename)
+		return generatePopStatic(c.staticSymbol(index)), nil
 	case token.SEGMENT_TEMP:
-		return generatePopTemp(index)
+		return generatePopTemp(c.layout.TempBase, index), nil
 	default:
-		return nil
+		return nil, fmt.Errorf("unsupported segment %q for pop", segment)
 	}
 }
 
@@ -243,20 +814,20 @@ func generatePopPointer(index int) []string {
 	return result
 }
 
-func generatePopStatic(index int, filename string) []string {
+func generatePopStatic(symbol string) []string {
 	var result []string
 	result = append(result, "@SP", "AM=M-1", "D=M") // move RAM[SP-1] to D
-	result = append(result, "@"+filename+"."+strconv.Itoa(index), "M=D")
+	result = append(result, "@"+symbol, "M=D")
 	return result
 }
 
-func generatePopTemp(index int) []string {
+func generatePopTemp(tempBase, index int) []string {
 	var result []string
-	result = append(result, "@R5", "D=A")                     // D = 5
-	result = append(result, "@"+strconv.Itoa(index), "D=D+A") // D = 5 + index
-	result = append(result, "@R13", "M=D")                    // R13 = D (temporarily store the address to pop)
-	result = append(result, "@SP", "AM=M-1", "D=M")           // move RAM[SP-1] to D
-	result = append(result, "@R13", "A=M", "M=D")             // RAM[R13] = D
+	result = append(result, "@"+strconv.Itoa(tempBase), "D=A") // D = tempBase
+	result = append(result, "@"+strconv.Itoa(index), "D=D+A")  // D = tempBase + index
+	result = append(result, "@R13", "M=D")                     // R13 = D (temporarily store the address to pop)
+	result = append(result, "@SP", "AM=M-1", "D=M")            // move RAM[SP-1] to D
+	result = append(result, "@R13", "A=M", "M=D")              // RAM[R13] = D
 	return result
 }
 
@@ -280,8 +851,7 @@ func generateNEG() []string {
 	return result
 }
 
-func generateCompare(command token.CommandSymbol, compareCount int) []string {
-	flag := strconv.Itoa(compareCount)
+func generateCompare(command token.CommandSymbol, trueLabel, endLabel string) []string {
 	var result []string
 	var jump string
 	switch command {
@@ -292,16 +862,52 @@ func generateCompare(command token.CommandSymbol, compareCount int) []string {
 	case token.GT:
 		jump = "JGT" // D > 0
 	}
-	result = append(result, "@SP", "AM=M-1", "D=M")                   // move RAM[SP-1] to D
-	result = append(result, "A=A-1", "D=M-D")                         // D = RAM[SP-2] - RAM[SP-1]
-	result = append(result, "@TRUE"+flag, "D;"+jump)                  // if <jump>, jump to TRUE
-	result = append(result, "@SP", "A=M-1", "M=0")                    // set RAM[SP-2] to 0 (false)
-	result = append(result, "@END"+flag, "0;JMP")                     // jump to END
-	result = append(result, "(TRUE"+flag+")", "@SP", "A=M-1", "M=-1") // set RAM[SP-2] to -1 (true)
-	result = append(result, "(END"+flag+")")
+	result = append(result, "@SP", "AM=M-1", "D=M")                    // move RAM[SP-1] to D
+	result = append(result, "A=A-1", "D=M-D")                          // D = RAM[SP-2] - RAM[SP-1]
+	result = append(result, "@"+trueLabel, "D;"+jump)                  // if <jump>, jump to TRUE
+	result = append(result, "@SP", "A=M-1", "M=0")                     // set RAM[SP-2] to 0 (false)
+	result = append(result, "@"+endLabel, "0;JMP")                     // jump to END
+	result = append(result, "("+trueLabel+")", "@SP", "A=M-1", "M=-1") // set RAM[SP-2] to -1 (true)
+	result = append(result, "("+endLabel+")")
 	return result
 }
 
+func generateCompareCall(command token.CommandSymbol, returnAddress string) []string {
+	var result []string
+	result = append(result, "@"+returnAddress, "D=A")                              // D = return address
+	result = append(result, "@$$"+string(command), "0;JMP", "("+returnAddress+")") // goto shared compare routine
+	return result
+}
+
+func generateCompareIf(command token.CommandSymbol, label string, negate bool) ([]string, error) {
+	var jump string
+	switch command {
+	case token.EQ:
+		jump = "JEQ" // D == 0
+		if negate {
+			jump = "JNE" // D != 0
+		}
+	case token.LT:
+		jump = "JLT" // D < 0
+		if negate {
+			jump = "JGE" // D >= 0
+		}
+	case token.GT:
+		jump = "JGT" // D > 0
+		if negate {
+			jump = "JLE" // D <= 0
+		}
+	default:
+		return nil, fmt.Errorf("unsupported comparison %q", command)
+	}
+	var result []string
+	result = append(result, "@SP", "AM=M-1", "D=M") // move RAM[SP-1] to D
+	result = append(result, "A=A-1", "D=M-D")       // D = RAM[SP-2] - RAM[SP-1]
+	result = append(result, "@SP", "M=M-1")         // SP--
+	result = append(result, "@"+label, "D;"+jump)   // if <jump>, jump to label
+	return result, nil
+}
+
 func generateAND() []string {
 	var result []string
 	result = append(result, "@SP", "AM=M-1", "D=M") // move RAM[SP-1] to D
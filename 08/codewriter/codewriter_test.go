@@ -0,0 +1,154 @@
+package codewriter_test
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/youchann/nand2tetris/08/codewriter"
+	"github.com/youchann/nand2tetris/08/internal/vmtest"
+	"github.com/youchann/nand2tetris/08/token"
+	"github.com/youchann/nand2tetris/08/translator"
+)
+
+// TestSharedRoutines runs the project 7 and 8 test programs with and without
+// shared routines and compares both runs with the .cmp files.
+func TestSharedRoutines(t *testing.T) {
+	vmtest.ForEach(t, vmtest.Roots, func(t *testing.T, s *vmtest.Script, files []token.File) {
+		for _, shared := range []bool{false, true} {
+			opts := codewriter.Options{SharedRoutines: shared, Layout: vmtest.Layout(files)}
+			if err := s.Run(files, opts); err != nil {
+				t.Errorf("shared routines %v: %v", shared, err)
+			}
+		}
+	})
+}
+
+// TestStackCheck runs the test programs with stack checking, which must not
+// change their results.
+func TestStackCheck(t *testing.T) {
+	vmtest.ForEach(t, vmtest.Roots, func(t *testing.T, s *vmtest.Script, files []token.File) {
+		for _, shared := range []bool{false, true} {
+			opts := codewriter.Options{SharedRoutines: shared, StackCheck: true, Layout: vmtest.Layout(files)}
+			if err := s.Run(files, opts); err != nil {
+				t.Errorf("shared routines %v: %v", shared, err)
+			}
+		}
+	})
+}
+
+// run translates a single file named Sys and runs it for a fixed number of
+// cycles. It returns the resulting RAM and the code writer.
+func run(t *testing.T, source string, opts codewriter.Options) ([]int16, *codewriter.CodeWriter) {
+	t.Helper()
+	file, err := translator.ParseFile("Sys", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var asm strings.Builder
+	c, err := translator.Translate(&asm, []token.File{file}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ram, err := (&vmtest.Script{Cycles: 100000}).RunHack(asm.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ram, c
+}
+
+func TestTraps(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		code     int
+		function string
+	}{
+		{
+			name: "overflow",
+			source: `function Sys.init 0
+call Sys.recurse 0
+return
+function Sys.recurse 0
+call Sys.recurse 0
+return
+`,
+			code:     codewriter.TrapStackOverflow,
+			function: "Sys.recurse",
+		},
+		{
+			name: "underflow",
+			source: `function Sys.init 1
+push constant 1
+add
+return
+`,
+			code:     codewriter.TrapStackUnderflow,
+			function: "Sys.init",
+		},
+	}
+	for _, tt := range tests {
+		for _, shared := range []bool{false, true} {
+			layout := codewriter.DefaultLayout()
+			ram, c := run(t, tt.source, codewriter.Options{SharedRoutines: shared, StackCheck: true, Layout: layout})
+			if code := ram[layout.TrapCodeAddress()]; int(code) != tt.code {
+				t.Errorf("%s, shared routines %v: trap code %d, want %d", tt.name, shared, code, tt.code)
+			}
+			want := slices.Index(c.TrapFunctions(), tt.function) + 1
+			if index := ram[layout.TrapFunctionAddress()]; want == 0 || int(index) != want {
+				t.Errorf("%s, shared routines %v: trap function %d, want %d (%s)", tt.name, shared, index, want, tt.function)
+			}
+		}
+	}
+}
+
+// TestScopedLabels checks that functions may use the same label names.
+func TestScopedLabels(t *testing.T) {
+	source := `function Sys.init 0
+goto END
+push constant 1
+pop temp 0
+label END
+call Sys.other 0
+pop temp 1
+label LOOP
+goto LOOP
+function Sys.other 0
+goto END
+push constant 2
+pop temp 2
+label END
+push constant 3
+return
+label LOOP
+goto LOOP
+`
+	ram, _ := run(t, source, codewriter.Options{Layout: codewriter.DefaultLayout()})
+	if got := ram[5:8]; !slices.Equal(got, []int16{0, 3, 0}) {
+		t.Errorf("temp 0-2 = %v, want [0 3 0]", got)
+	}
+}
+
+func TestIndexOutOfRange(t *testing.T) {
+	tests := []struct {
+		segment token.Segment
+		index   int
+	}{
+		{token.SEGMENT_LOCAL, -1},
+		{token.SEGMENT_STATIC, -1},
+		{token.SEGMENT_POINTER, 2},
+		{token.SEGMENT_TEMP, 8},
+	}
+	for _, tt := range tests {
+		for _, command := range []token.CommandType{token.C_PUSH, token.C_POP} {
+			c, err := codewriter.New(io.Discard, codewriter.Options{Layout: codewriter.DefaultLayout()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.WritePushPop(command, tt.segment, tt.index); err == nil {
+				t.Errorf("%s %s %d: no error", command, tt.segment, tt.index)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package codewriter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+)
+
+// Fragment returns a CodeWriter that translates the file filename into a
+// buffer of its own, so that files can be translated concurrently and then
+// joined with Append. staticOffset is the number of static variables and
+// functionOffset the number of functions in the files that come before it.
+func (c *CodeWriter) Fragment(filename string, staticOffset, functionOffset int) *CodeWriter {
+	f := &CodeWriter{
+		writer:         nil,
+		filename:       filename,
+		function:       "",
+		lineCount:      0,
+		romSize:        0,
+		compareCount:   map[string]int{},
+		callCount:      map[string]int{},
+		sharedRoutines: c.sharedRoutines,
+		usedRoutines:   map[string]bool{},
+		annotate:       c.annotate,
+		sourceMap:      nil,
+		layout:         c.layout,
+		staticAddress:  map[string]int{},
+		statics:        nil,
+		stackCheck:     c.stackCheck,
+		numLocals:      0,
+		trapFunctions:  nil,
+		inlineFrames:   nil,
+		buffer:         &bytes.Buffer{},
+		staticOffset:   staticOffset,
+		functionOffset: functionOffset,
+	}
+	f.writer = bufio.NewWriter(f.buffer)
+	return f
+}
+
+// Append writes the assembly of a finished fragment to c. Fragments must be
+// appended in the order of their files for the output to be stable.
+func (c *CodeWriter) Append(f *CodeWriter) error {
+	if f.buffer == nil {
+		return fmt.Errorf("append: %s is not a fragment", f.filename)
+	}
+	if len(c.statics) != f.staticOffset || c.stackCheck && len(c.trapFunctions) != f.functionOffset {
+		return fmt.Errorf("append: fragment %s is out of order", f.filename)
+	}
+	if err := f.writer.Flush(); err != nil {
+		return err
+	}
+	if _, err := c.writer.Write(f.buffer.Bytes()); err != nil {
+		return err
+	}
+	for _, entry := range f.sourceMap {
+		entry.AsmLine += c.lineCount
+		entry.ROMAddress += c.romSize
+		c.sourceMap = append(c.sourceMap, entry)
+	}
+	c.lineCount += f.lineCount
+	c.romSize += f.romSize
+	for routine := range f.usedRoutines {
+		c.usedRoutines[routine] = true
+	}
+	c.statics = append(c.statics, f.statics...)
+	c.trapFunctions = append(c.trapFunctions, f.trapFunctions...)
+	return nil
+}
@@ -0,0 +1,103 @@
+package codewriter
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// InlineFrame describes the frame that an inlined function body needs. The
+// body must leave exactly one value, its return value, on top of the stack.
+type InlineFrame struct {
+	NumArgs   int
+	NumLocals int
+	SaveThis  bool // the body pops pointer 0
+	SaveThat  bool // the body pops pointer 1
+}
+
+type inlineFrame struct {
+	InlineFrame
+	callerLocals int
+}
+
+// saved returns the registers that are pushed on entry, in push order. ARG
+// comes first so that it is restored last.
+func (f InlineFrame) saved() []string {
+	var registers []string
+	if f.NumArgs > 0 {
+		registers = append(registers, "ARG")
+	}
+	if f.NumLocals > 0 {
+		registers = append(registers, "LCL")
+	}
+	if f.SaveThis {
+		registers = append(registers, "THIS")
+	}
+	if f.SaveThat {
+		registers = append(registers, "THAT")
+	}
+	return registers
+}
+
+// WriteInlineEnter sets up the frame of an inlined function body, whose
+// arguments are the top frame.NumArgs values on the stack. Unlike a call, it
+// only saves the registers that the body changes and does not jump.
+func (c *CodeWriter) WriteInlineEnter(frame InlineFrame) error {
+	var assembly []string
+	for _, register := range frame.saved() {
+		assembly = append(assembly, "@"+register, "D=M", "@SP", "A=M", "M=D", "@SP", "M=M+1") // push register
+		if register == "ARG" {
+			assembly = append(assembly, "@SP", "D=M", "@"+strconv.Itoa(frame.NumArgs+1), "D=D-A", "@ARG", "M=D") // ARG = SP - nArgs - 1
+		}
+	}
+	if frame.NumLocals > 0 {
+		assembly = append(assembly, "@SP", "D=M", "@LCL", "M=D") // LCL = SP
+		for i := 0; i < frame.NumLocals; i++ {
+			assembly = append(assembly, "@SP", "A=M", "M=0", "@SP", "M=M+1") // push 0
+		}
+	}
+	if err := c.writeChecked(frame.NumArgs, len(assembly) > 0, assembly); err != nil {
+		return err
+	}
+	c.inlineFrames = append(c.inlineFrames, inlineFrame{InlineFrame: frame, callerLocals: c.numLocals})
+	if frame.NumLocals > 0 {
+		c.numLocals = frame.NumLocals
+	}
+	return nil
+}
+
+// WriteInlineReturn tears down the innermost inlined frame, leaving the
+// return value in place of the arguments.
+func (c *CodeWriter) WriteInlineReturn() error {
+	if len(c.inlineFrames) == 0 {
+		return fmt.Errorf("inline return without a matching inline enter")
+	}
+	frame := c.inlineFrames[len(c.inlineFrames)-1]
+	saved := frame.saved()
+	var assembly []string
+	if len(saved) > 0 {
+		assembly = append(assembly, "@SP", "AM=M-1", "D=M", "@R13", "M=D") // R13 = return value
+		if frame.NumLocals > 0 {
+			assembly = append(assembly, "@LCL", "D=M", "@SP", "M=D") // drop the locals
+		}
+		for i := len(saved) - 1; i >= 0; i-- {
+			target := saved[i]
+			if target == "ARG" {
+				target = "R14" // the body's ARG is still needed to place the return value
+			}
+			assembly = append(assembly, "@SP", "AM=M-1", "D=M", "@"+target, "M=D") // pop register
+		}
+		if frame.NumArgs > 0 {
+			assembly = append(assembly, "@R13", "D=M", "@ARG", "A=M", "M=D") // *ARG = return value
+			assembly = append(assembly, "@ARG", "D=M+1", "@SP", "M=D")       // SP = ARG + 1
+			assembly = append(assembly, "@R14", "D=M", "@ARG", "M=D")        // restore ARG
+		} else {
+			assembly = append(assembly, "@R13", "D=M", "@SP", "A=M", "M=D", "@SP", "M=M+1") // push return value
+		}
+	}
+	if err := c.writeChecked(1, false, assembly); err != nil {
+		return err
+	}
+	c.inlineFrames = c.inlineFrames[:len(c.inlineFrames)-1]
+	c.numLocals = frame.callerLocals
+	return nil
+}
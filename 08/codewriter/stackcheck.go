@@ -0,0 +1,107 @@
+package codewriter
+
+import (
+	"strconv"
+)
+
+// TrapCodeAddress and TrapFunctionAddress are the two words just below the
+// stack base. When a stack check fails, the program stores the error code
+// in the first and the index of the offending function in the second, then
+// loops forever. Index 0 stands for code outside any function; the other
+// indexes are listed by TrapFunctions. The words are reserved only when
+// StackCheck is on, and unlike R13-R15 no generated code uses them as
+// scratch space.
+func (l Layout) TrapCodeAddress() int {
+	return l.StackBase - 2
+}
+
+func (l Layout) TrapFunctionAddress() int {
+	return l.StackBase - 1
+}
+
+// callFrameSize is the number of words a call pushes before it jumps.
+const callFrameSize = 5
+
+const (
+	TrapStackOverflow  = 1 // SP went past the stack limit
+	TrapStackUnderflow = 2 // a command popped below the base of its frame
+)
+
+// TrapFunctions returns the functions that can be reported by a trap, where
+// the function at position i has index i+1.
+func (c *CodeWriter) TrapFunctions() []string {
+	return c.trapFunctions
+}
+
+func (c *CodeWriter) enterCheckedFunction(functionName string) {
+	if c.stackCheck {
+		c.trapFunctions = append(c.trapFunctions, functionName)
+	}
+}
+
+// writeChecked writes assembly for a command that pops operands values off
+// the stack, preceded by an underflow check and, if the command grows the
+// stack, followed by an overflow check.
+func (c *CodeWriter) writeChecked(operands int, grows bool, assembly []string) error {
+	if !c.stackCheck {
+		return c.write(assembly)
+	}
+	c.usedRoutines["trap"] = true
+	var result []string
+	if operands > 0 {
+		result = append(result, c.generateUnderflowCheck(operands)...)
+	}
+	result = append(result, assembly...)
+	if grows {
+		result = append(result, c.generateOverflowCheck(0)...)
+	}
+	return c.write(result)
+}
+
+func (c *CodeWriter) trapIndex() int {
+	if c.function == "" {
+		return 0
+	}
+	return c.functionOffset + len(c.trapFunctions)
+}
+
+// generateOverflowCheck traps if words more values would take SP past the
+// stack limit.
+func (c *CodeWriter) generateOverflowCheck(words int) []string {
+	trap := "$$trap.overflow." + strconv.Itoa(c.trapIndex())
+	var result []string
+	result = append(result, "@SP", "D=M", "@"+strconv.Itoa(c.layout.StackLimit-words), "D=D-A") // D = SP - (StackLimit - words)
+	result = append(result, "@"+trap, "D;JGT")                                                  // if SP + words > StackLimit, trap
+	return result
+}
+
+// generateUnderflowCheck makes sure that at least operands values lie above
+// the frame base, which is LCL + numLocals inside a function and the stack
+// base outside of one.
+func (c *CodeWriter) generateUnderflowCheck(operands int) []string {
+	trap := "$$trap.underflow." + strconv.Itoa(c.trapIndex())
+	var result []string
+	if c.function == "" {
+		result = append(result, "@SP", "D=M", "@"+strconv.Itoa(c.layout.StackBase+operands), "D=D-A") // D = SP - (StackBase + operands)
+		result = append(result, "@"+trap, "D;JLT")                                                    // if SP < StackBase + operands, trap
+		return result
+	}
+	result = append(result, "@LCL", "D=M", "@"+strconv.Itoa(c.numLocals+operands), "D=D+A") // D = LCL + numLocals + operands
+	result = append(result, "@SP", "D=D-M", "@"+trap, "D;JGT")                              // if SP < D, trap
+	return result
+}
+
+func (c *CodeWriter) generateTrapRoutines() []string {
+	var result []string
+	for i := 0; i <= len(c.trapFunctions); i++ {
+		index := strconv.Itoa(i)
+		result = append(result, "($$trap.overflow."+index+")", "@"+index, "D=A", "@$$trap.overflow", "0;JMP")
+		result = append(result, "($$trap.underflow."+index+")", "@"+index, "D=A", "@$$trap.underflow", "0;JMP")
+	}
+	result = append(result, "($$trap.overflow)", "@"+strconv.Itoa(c.layout.TrapFunctionAddress()), "M=D")                              // RAM[TrapFunctionAddress] = function index
+	result = append(result, "@"+strconv.Itoa(TrapStackOverflow), "D=A", "@$$trap", "0;JMP")                                            // D = error code
+	result = append(result, "($$trap.underflow)", "@"+strconv.Itoa(c.layout.TrapFunctionAddress()), "M=D")                             // RAM[TrapFunctionAddress] = function index
+	result = append(result, "@"+strconv.Itoa(TrapStackUnderflow), "D=A")                                                               // D = error code
+	result = append(result, "($$trap)", "@"+strconv.Itoa(c.layout.TrapCodeAddress()), "M=D", "($$trap.halt)", "@$$trap.halt", "0;JMP") // RAM[TrapCodeAddress] = error code, halt
+	return result
+}
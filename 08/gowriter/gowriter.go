@@ -0,0 +1,348 @@
+package gowriter
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/youchann/nand2tetris/08/codewriter"
+	"github.com/youchann/nand2tetris/08/token"
+)
+
+// GoWriter translates VM commands into a self-contained Go program that runs
+// the VM directly on a 32K-word RAM, without emulating the Hack CPU. It has
+// the same Write* methods as the CodeWriter but does not accept the fused
+// commands of the optimizer.
+type GoWriter struct {
+	writer io.Writer
+	// buffer holds the program until Close formats it.
+	buffer   bytes.Buffer
+	layout   codewriter.Layout
+	filename string
+	// function is the VM function being translated, "" for the commands
+	// that precede the first function.
+	function string
+	body     []statement
+	top      []statement
+	defined  map[string]bool
+	called   map[string]bool
+	static   map[string]int
+	started  bool // whether the header and runtime have been written
+}
+
+// statement is one line of a generated function body. label is set for
+// the line that defines a VM label and target for lines that jump to one.
+type statement struct {
+	code   string
+	label  string
+	target string
+}
+
+func New(w io.Writer, layout codewriter.Layout) *GoWriter {
+	return &GoWriter{
+		writer:   w,
+		layout:   layout,
+		filename: "",
+		function: "",
+		body:     nil,
+		top:      nil,
+		defined:  map[string]bool{},
+		called:   map[string]bool{},
+		static:   map[string]int{},
+		started:  false,
+	}
+}
+
+func (g *GoWriter) Setfilename(filename string) {
+	g.filename = filename
+}
+
+func (g *GoWriter) WriteArithmetic(command token.CommandSymbol) error {
+	switch command {
+	case token.ADD, token.SUB, token.NEG, token.EQ, token.GT, token.LT, token.AND, token.OR, token.NOT:
+		return g.emit("m." + string(command) + "()")
+	default:
+		return fmt.Errorf("unsupported arithmetic command %q", command)
+	}
+}
+
+func (g *GoWriter) WritePushPop(command token.CommandType, segment token.Segment, index int) error {
+	switch command {
+	case token.C_PUSH:
+		if segment == token.SEGMENT_CONSTANT {
+			if index < codewriter.MinConstant || index > codewriter.MaxConstant {
+				return fmt.Errorf("constant %d out of 16-bit range [%d, %d]", index, codewriter.MinConstant, codewriter.MaxConstant)
+			}
+			return g.emit("m.push(" + strconv.Itoa(int(int16(index))) + ")")
+		}
+		value, err := g.load(segment, index)
+		if err != nil {
+			return err
+		}
+		return g.emit("m.push(" + value + ")")
+	case token.C_POP:
+		code, err := g.store(segment, index, "m.pop()")
+		if err != nil {
+			return err
+		}
+		return g.emit(code)
+	default:
+		return fmt.Errorf("unsupported command %q, expected push or pop", command)
+	}
+}
+
+func (g *GoWriter) WriteLabel(label string) error {
+	g.body = append(g.body, statement{code: goLabel(label) + ":", label: label})
+	return g.emit("m.tick()")
+}
+
+func (g *GoWriter) WriteGoto(label string) error {
+	// "label X / goto X" is how VM programs halt. Translating it literally
+	// would spin forever, so the program stops instead.
+	if n := len(g.body); n >= 2 && g.body[n-2].label == label {
+		return g.emit("m.halt()")
+	}
+	g.body = append(g.body, statement{code: "goto " + goLabel(label), target: label})
+	return nil
+}
+
+func (g *GoWriter) WriteIf(label string) error {
+	g.body = append(g.body, statement{code: "if m.pop() != 0 {\n\t\tgoto " + goLabel(label) + "\n\t}", target: label})
+	return nil
+}
+
+func (g *GoWriter) WriteFunction(functionName string, numLocals int) error {
+	if err := g.flushFunction(functionName); err != nil {
+		return err
+	}
+	if g.defined[functionName] {
+		return fmt.Errorf("function %s is defined twice", functionName)
+	}
+	g.defined[functionName] = true
+	g.function = functionName
+	return g.emit("m.enter(" + strconv.Itoa(numLocals) + ")")
+}
+
+func (g *GoWriter) WriteReturn() error {
+	return g.emit("m.ret()\n\treturn")
+}
+
+func (g *GoWriter) WriteCall(functionName string, numArgs int) error {
+	g.called[functionName] = true
+	return g.emit("m.call(" + goFunction(functionName) + ", " + strconv.Itoa(numArgs) + ")")
+}
+
+// Close writes the program and reports calls to functions that are not
+// defined.
+func (g *GoWriter) Close() error {
+	if err := g.flushFunction(""); err != nil {
+		return err
+	}
+	for name := range g.called {
+		if !g.defined[name] {
+			return fmt.Errorf("call to undefined function %s", name)
+		}
+	}
+	if g.layout.Bootstrap && !g.defined[g.layout.Entry] {
+		return fmt.Errorf("bootstrap calls %s, which is not defined", g.layout.Entry)
+	}
+	if err := g.writeStart(); err != nil {
+		return err
+	}
+	source, err := format.Source(g.buffer.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting generated program: %w", err)
+	}
+	_, err = g.writer.Write(source)
+	return err
+}
+
+func (g *GoWriter) emit(code string) error {
+	g.body = append(g.body, statement{code: code})
+	return nil
+}
+
+// flushFunction writes out the function collected so far. Labels that no
+// goto refers to are dropped, because Go rejects unused labels. Code that
+// can run off its end continues with the next function, as it does in ROM.
+func (g *GoWriter) flushFunction(next string) error {
+	if next != "" && !terminates(g.body) {
+		g.emit(goFunction(next) + "(m)")
+	}
+	if g.function == "" {
+		g.top = append(g.top, g.body...)
+		g.body = nil
+		return nil
+	}
+	lines, err := functionBody(g.function, g.body)
+	if err != nil {
+		return err
+	}
+	g.writeHeader()
+	g.write("\n// " + g.function + "\nfunc " + goFunction(g.function) + "(m *Machine) {\n" + lines + "}\n")
+	g.body = nil
+	return nil
+}
+
+func terminates(body []statement) bool {
+	if len(body) == 0 {
+		return false
+	}
+	last := body[len(body)-1].code
+	return strings.HasPrefix(last, "m.ret()") || strings.HasPrefix(last, "goto ") || last == "m.halt()"
+}
+
+func functionBody(function string, body []statement) (string, error) {
+	defined := map[string]bool{}
+	used := map[string]bool{}
+	for _, s := range body {
+		if s.label != "" {
+			defined[s.label] = true
+		}
+		if s.target != "" {
+			used[s.target] = true
+		}
+	}
+	for _, s := range body {
+		if s.target != "" && !defined[s.target] {
+			if function == "" {
+				return "", fmt.Errorf("label %s is not defined outside functions", s.target)
+			}
+			return "", fmt.Errorf("label %s is not defined in %s", s.target, function)
+		}
+	}
+	var b strings.Builder
+	for _, s := range body {
+		if s.label != "" {
+			if used[s.label] {
+				b.WriteString(s.code + "\n")
+			}
+			continue
+		}
+		b.WriteString("\t" + s.code + "\n")
+	}
+	return b.String(), nil
+}
+
+func (g *GoWriter) writeHeader() {
+	if g.started {
+		return
+	}
+	g.started = true
+	g.write("// Code generated by the VM translator. DO NOT EDIT.\n\n")
+	g.write("package main\n\nimport (\n\t\"flag\"\n\t\"fmt\"\n\t\"os\"\n\t\"strconv\"\n\t\"strings\"\n)\n")
+	g.write(runtime)
+}
+
+// writeStart writes the start method, which either runs the bootstrap or
+// the commands that precede the first function.
+func (g *GoWriter) writeStart() error {
+	g.writeHeader()
+	var start []statement
+	if g.layout.Bootstrap {
+		start = append(start, statement{code: "m.RAM[SP] = " + strconv.Itoa(g.layout.StackBase)})
+		start = append(start, statement{code: "m.call(" + goFunction(g.layout.Entry) + ", 0)"})
+	}
+	start = append(start, g.top...)
+	lines, err := functionBody("", start)
+	if err != nil {
+		return err
+	}
+	g.write("\nfunc (m *Machine) start() {\n" + lines + "}\n")
+	return nil
+}
+
+func (g *GoWriter) write(s string) {
+	g.buffer.WriteString(s)
+}
+
+func (g *GoWriter) load(segment token.Segment, index int) (string, error) {
+	switch segment {
+	case token.SEGMENT_LOCAL, token.SEGMENT_ARGUMENT, token.SEGMENT_THIS, token.SEGMENT_THAT:
+		return "m.load(" + segmentAddress(segment, index) + ")", nil
+	case token.SEGMENT_POINTER, token.SEGMENT_TEMP, token.SEGMENT_STATIC:
+		address, err := g.fixedAddress(segment, index)
+		if err != nil {
+			return "", err
+		}
+		return "m.RAM[" + address + "]", nil
+	default:
+		return "", fmt.Errorf("unsupported segment %q for push", segment)
+	}
+}
+
+func (g *GoWriter) store(segment token.Segment, index int, value string) (string, error) {
+	switch segment {
+	case token.SEGMENT_LOCAL, token.SEGMENT_ARGUMENT, token.SEGMENT_THIS, token.SEGMENT_THAT:
+		return "m.store(" + segmentAddress(segment, index) + ", " + value + ")", nil
+	case token.SEGMENT_POINTER, token.SEGMENT_TEMP, token.SEGMENT_STATIC:
+		address, err := g.fixedAddress(segment, index)
+		if err != nil {
+			return "", err
+		}
+		return "m.RAM[" + address + "] = " + value, nil
+	default:
+		return "", fmt.Errorf("unsupported segment %q for pop", segment)
+	}
+}
+
+func segmentAddress(segment token.Segment, index int) string {
+	base := map[token.Segment]string{
+		token.SEGMENT_LOCAL:    "LCL",
+		token.SEGMENT_ARGUMENT: "ARG",
+		token.SEGMENT_THIS:     "THIS",
+		token.SEGMENT_THAT:     "THAT",
+	}[segment]
+	return "int(m.RAM[" + base + "])+" + strconv.Itoa(index)
+}
+
+// fixedAddress returns the RAM address of a pointer, temp or static entry.
+// Statics are allocated in order of first use from the static base, like
+// the assembler does for the Hack translation.
+func (g *GoWriter) fixedAddress(segment token.Segment, index int) (string, error) {
+	if index < 0 {
+		return "", fmt.Errorf("%s index %d out of range", segment, index)
+	}
+	switch segment {
+	case token.SEGMENT_POINTER:
+		if index > 1 {
+			return "", fmt.Errorf("pointer index %d out of range", index)
+		}
+		return strconv.Itoa(3 + index), nil
+	case token.SEGMENT_TEMP:
+		if index > 7 {
+			return "", fmt.Errorf("temp index %d out of range", index)
+		}
+		return strconv.Itoa(g.layout.TempBase + index), nil
+	default:
+		symbol := g.filename + "." + strconv.Itoa(index)
+		address, ok := g.static[symbol]
+		if !ok {
+			base := g.layout.StaticBase
+			if base == 0 {
+				base = 16
+			}
+			address = base + len(g.static)
+			g.static[symbol] = address
+		}
+		return strconv.Itoa(address), nil
+	}
+}
+
+// goFunction maps a VM function name to a Go identifier. '_' is doubled so
+// that the escapes of '.', ':' and '$' cannot collide with it.
+func goFunction(name string) string {
+	return "vm_" + escape(name)
+}
+
+func goLabel(label string) string {
+	return "L_" + escape(label)
+}
+
+func escape(name string) string {
+	r := strings.NewReplacer("_", "__", ".", "_0", ":", "_1", "$", "_2")
+	return r.Replace(name)
+}
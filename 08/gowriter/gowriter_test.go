@@ -0,0 +1,96 @@
+package gowriter_test
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/youchann/nand2tetris/08/codewriter"
+	"github.com/youchann/nand2tetris/08/gowriter"
+	"github.com/youchann/nand2tetris/08/internal/vmtest"
+	"github.com/youchann/nand2tetris/08/token"
+	"github.com/youchann/nand2tetris/08/translator"
+)
+
+// TestMatchesEmulator builds a Go program from each project 7 and 8 test program,
+// runs it with the RAM set up by the test script and compares the result
+// with the .cmp file.
+func TestMatchesEmulator(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds and runs Go programs")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	vmtest.ForEach(t, vmtest.Roots, func(t *testing.T, s *vmtest.Script, files []token.File) {
+		work := t.TempDir()
+		program, err := os.Create(filepath.Join(work, "main.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = translator.TranslateToGo(program, files, vmtest.Layout(files))
+		if cerr := program.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var addresses []string
+		for _, address := range s.Outputs {
+			addresses = append(addresses, strconv.Itoa(address))
+		}
+		// Every step takes at least one Hack cycle, so the step limit
+		// only stops programs that would not finish in the emulator.
+		args := []string{"run", "main.go", "-steps", strconv.Itoa(s.Cycles), "-print", strings.Join(addresses, ",")}
+		for _, a := range s.Setup {
+			args = append(args, strconv.Itoa(a.Address)+"="+strconv.Itoa(a.Value))
+		}
+		cmd := exec.Command(goTool, args...)
+		cmd.Dir = work
+		cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+
+		ram := make([]int16, 32768)
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			var address, value int
+			if _, err := fmt.Sscanf(line, "RAM[%d]=%d", &address, &value); err != nil {
+				t.Fatalf("unexpected output %q", line)
+			}
+			ram[address] = int16(value)
+		}
+		if err := s.Check(ram); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestIndexOutOfRange(t *testing.T) {
+	tests := []struct {
+		segment token.Segment
+		index   int
+	}{
+		{token.SEGMENT_STATIC, -1},
+		{token.SEGMENT_POINTER, -1},
+		{token.SEGMENT_POINTER, 2},
+		{token.SEGMENT_TEMP, -1},
+		{token.SEGMENT_TEMP, 8},
+	}
+	for _, tt := range tests {
+		for _, command := range []token.CommandType{token.C_PUSH, token.C_POP} {
+			g := gowriter.New(io.Discard, codewriter.DefaultLayout())
+			if err := g.WritePushPop(command, tt.segment, tt.index); err == nil {
+				t.Errorf("%s %s %d: no error", command, tt.segment, tt.index)
+			}
+		}
+	}
+}
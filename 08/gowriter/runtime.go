@@ -0,0 +1,176 @@
+package gowriter
+
+// runtime is the part of every generated program that does not depend on
+// the VM code: the machine, its memory mapped I/O hooks and the main
+// function. The generated functions and the start method follow it.
+const runtime = `
+const (
+	SP   = 0
+	LCL  = 1
+	ARG  = 2
+	THIS = 3
+	THAT = 4
+
+	ScreenBase  = 16384
+	ScreenEnd   = 24576
+	KeyboardMap = 24576
+)
+
+// Machine holds the RAM of the VM and the hooks for its memory mapped I/O.
+type Machine struct {
+	RAM []int16
+	// ScreenWrite is called after every write to the screen memory map.
+	ScreenWrite func(address int, value int16)
+	// KeyboardRead supplies the value of the keyboard memory map.
+	KeyboardRead func() int16
+	// MaxSteps stops the program after that many labels and function
+	// entries have been passed. Zero means no limit.
+	MaxSteps int
+	Steps    int
+}
+
+type halt struct{}
+
+func NewMachine() *Machine {
+	return &Machine{RAM: make([]int16, 32768)}
+}
+
+// Run executes the program until it returns, halts or runs out of steps.
+func (m *Machine) Run() {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(halt); !ok {
+				panic(r)
+			}
+		}
+	}()
+	m.start()
+}
+
+func (m *Machine) halt() {
+	panic(halt{})
+}
+
+func (m *Machine) tick() {
+	m.Steps++
+	if m.MaxSteps > 0 && m.Steps >= m.MaxSteps {
+		m.halt()
+	}
+}
+
+func (m *Machine) load(address int) int16 {
+	if address == KeyboardMap && m.KeyboardRead != nil {
+		return m.KeyboardRead()
+	}
+	return m.RAM[address]
+}
+
+func (m *Machine) store(address int, value int16) {
+	m.RAM[address] = value
+	if address >= ScreenBase && address < ScreenEnd && m.ScreenWrite != nil {
+		m.ScreenWrite(address, value)
+	}
+}
+
+func (m *Machine) push(value int16) {
+	m.RAM[m.RAM[SP]] = value
+	m.RAM[SP]++
+}
+
+func (m *Machine) pop() int16 {
+	m.RAM[SP]--
+	return m.RAM[m.RAM[SP]]
+}
+
+func (m *Machine) binary(f func(x, y int16) int16) {
+	y := m.pop()
+	x := m.pop()
+	m.push(f(x, y))
+}
+
+func truth(b bool) int16 {
+	if b {
+		return -1
+	}
+	return 0
+}
+
+func (m *Machine) add() { m.binary(func(x, y int16) int16 { return x + y }) }
+func (m *Machine) sub() { m.binary(func(x, y int16) int16 { return x - y }) }
+func (m *Machine) and() { m.binary(func(x, y int16) int16 { return x & y }) }
+func (m *Machine) or()  { m.binary(func(x, y int16) int16 { return x | y }) }
+func (m *Machine) eq()  { m.binary(func(x, y int16) int16 { return truth(x == y) }) }
+func (m *Machine) gt()  { m.binary(func(x, y int16) int16 { return truth(x > y) }) }
+func (m *Machine) lt()  { m.binary(func(x, y int16) int16 { return truth(x < y) }) }
+func (m *Machine) neg() { m.push(-m.pop()) }
+func (m *Machine) not() { m.push(^m.pop()) }
+
+// call builds the same frame as the Hack translation, with 0 in place of
+// the return address.
+func (m *Machine) call(f func(*Machine), nArgs int) {
+	m.push(0)
+	m.push(m.RAM[LCL])
+	m.push(m.RAM[ARG])
+	m.push(m.RAM[THIS])
+	m.push(m.RAM[THAT])
+	m.RAM[ARG] = m.RAM[SP] - 5 - int16(nArgs)
+	m.RAM[LCL] = m.RAM[SP]
+	f(m)
+}
+
+func (m *Machine) enter(nLocals int) {
+	m.tick()
+	for i := 0; i < nLocals; i++ {
+		m.push(0)
+	}
+}
+
+func (m *Machine) ret() {
+	frame := m.RAM[LCL]
+	m.RAM[m.RAM[ARG]] = m.pop()
+	m.RAM[SP] = m.RAM[ARG] + 1
+	m.RAM[THAT] = m.RAM[frame-1]
+	m.RAM[THIS] = m.RAM[frame-2]
+	m.RAM[ARG] = m.RAM[frame-3]
+	m.RAM[LCL] = m.RAM[frame-4]
+}
+
+// main sets RAM from address=value arguments, runs the program and prints
+// the addresses listed by -print.
+func main() {
+	steps := flag.Int("steps", 0, "stop after this many labels and function entries (0 means no limit)")
+	addresses := flag.String("print", "", "comma separated addresses or address ranges (a-b) to print after the run")
+	flag.Parse()
+	m := NewMachine()
+	m.MaxSteps = *steps
+	for _, arg := range flag.Args() {
+		address, value, ok := strings.Cut(arg, "=")
+		a, err1 := strconv.Atoi(address)
+		v, err2 := strconv.Atoi(value)
+		if !ok || err1 != nil || err2 != nil {
+			fmt.Fprintf(os.Stderr, "Error: expected address=value, got %q\n", arg)
+			os.Exit(1)
+		}
+		m.RAM[a] = int16(v)
+	}
+	m.Run()
+	if *addresses == "" {
+		return
+	}
+	for _, field := range strings.Split(*addresses, ",") {
+		first, last, found := strings.Cut(field, "-")
+		if !found {
+			last = first
+		}
+		a, err1 := strconv.Atoi(first)
+		b, err2 := strconv.Atoi(last)
+		if err1 != nil || err2 != nil {
+			fmt.Fprintf(os.Stderr, "Error: bad address %q\n", field)
+			os.Exit(1)
+		}
+		for address := a; address <= b; address++ {
+			fmt.Printf("RAM[%d]=%d\n", address, m.RAM[address])
+		}
+	}
+}
+`
@@ -0,0 +1,92 @@
+package inliner
+
+import (
+	"github.com/youchann/nand2tetris/08/callgraph"
+	"github.com/youchann/nand2tetris/08/token"
+	"github.com/youchann/nand2tetris/vmir"
+)
+
+// Inline replaces every call to a small function with an inline command
+// that carries the callee's commands. A function is small if its body, not
+// counting the function and return commands, has at most maxCommands
+// commands. It returns the new files and the names of the inlined functions
+// in source order.
+//
+// Only straight-line bodies made of push, pop and arithmetic commands that
+// leave exactly one value on the stack are inlined. Such a body cannot call
+// anything, so recursion is never inlined. A body that uses static variables
+// is only inlined into its own file.
+func Inline(files []token.File, maxCommands int) ([]token.File, []string) {
+	g := callgraph.New(files)
+	candidates := map[string]*callgraph.Function{}
+	for _, f := range g.Functions {
+		if g.Function(f.Name) == f && inlinable(f, maxCommands) {
+			candidates[f.Name] = f
+		}
+	}
+
+	inlined := map[string]bool{}
+	var result []token.File
+	for _, file := range files {
+		rewritten := token.File{Name: file.Name}
+		for _, command := range file.Commands {
+			callee := candidates[command.Name]
+			if command.Op == vmir.Call && callee != nil && (callee.File == file.Name || !usesStatics(callee)) {
+				inlined[callee.Name] = true
+				command.Op = token.INLINE
+				command.Parts = callee.Commands
+			}
+			rewritten.Commands = append(rewritten.Commands, command)
+		}
+		result = append(result, rewritten)
+	}
+
+	var names []string
+	for _, f := range g.Functions {
+		if inlined[f.Name] {
+			names = append(names, f.Name)
+		}
+	}
+	return result, names
+}
+
+func inlinable(f *callgraph.Function, maxCommands int) bool {
+	last := len(f.Commands) - 1
+	if last < 1 || f.Commands[last].Op != vmir.Return || last-1 > maxCommands {
+		return false
+	}
+	depth := 0 // values the body has pushed so far
+	for _, command := range f.Commands[1:last] {
+		operands, results := 0, 0
+		switch {
+		case command.Op == vmir.Push:
+			results = 1
+		case command.Op == vmir.Pop:
+			if command.Segment == vmir.Constant {
+				return false
+			}
+			operands = 1
+		case command.Op.IsArithmetic():
+			operands, results = 2, 1
+			if command.Op == vmir.Neg || command.Op == vmir.Not {
+				operands = 1
+			}
+		default:
+			return false
+		}
+		if depth < operands {
+			return false
+		}
+		depth += results - operands
+	}
+	return depth == 1
+}
+
+func usesStatics(f *callgraph.Function) bool {
+	for _, command := range f.Commands {
+		if (command.Op == vmir.Push || command.Op == vmir.Pop) && command.Segment == vmir.Static {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package inliner_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/youchann/nand2tetris/08/codewriter"
+	"github.com/youchann/nand2tetris/08/inliner"
+	"github.com/youchann/nand2tetris/08/internal/vmtest"
+	"github.com/youchann/nand2tetris/08/token"
+	"github.com/youchann/nand2tetris/08/translator"
+)
+
+// TestPreservesBehavior runs the project 7 and 8 test programs with and
+// without inlining, in each code writer mode, and compares the runs with
+// the .cmp files.
+func TestPreservesBehavior(t *testing.T) {
+	vmtest.ForEach(t, vmtest.Roots, func(t *testing.T, s *vmtest.Script, files []token.File) {
+		inlined, _ := inliner.Inline(files, 20)
+		for _, shared := range []bool{false, true} {
+			for _, stackCheck := range []bool{false, true} {
+				opts := codewriter.Options{SharedRoutines: shared, StackCheck: stackCheck, Layout: vmtest.Layout(files)}
+				if err := s.Run(files, opts); err != nil {
+					t.Errorf("shared routines %v, stack check %v, without inlining: %v", shared, stackCheck, err)
+				}
+				if err := s.Run(inlined, opts); err != nil {
+					t.Errorf("shared routines %v, stack check %v, with inlining: %v", shared, stackCheck, err)
+				}
+			}
+		}
+	})
+}
+
+func TestInline(t *testing.T) {
+	file, err := translator.ParseFile("Sys", `function Sys.init 0
+push constant 2
+call Sys.double 1
+call Sys.one 0
+add
+pop temp 0
+label HALT
+goto HALT
+function Sys.double 0
+push argument 0
+push argument 0
+add
+return
+function Sys.one 0
+push constant 1
+return
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, names := inliner.Inline([]token.File{file}, 20)
+	if want := []string{"Sys.double", "Sys.one"}; !slices.Equal(names, want) {
+		t.Errorf("inlined %v, want %v", names, want)
+	}
+	for _, command := range files[0].Commands {
+		if command.Op == token.CALL {
+			t.Errorf("line %d: %s was not inlined", command.Pos.Line, command)
+		}
+	}
+
+	for _, stackCheck := range []bool{false, true} {
+		var asm strings.Builder
+		opts := codewriter.Options{StackCheck: stackCheck, Layout: codewriter.DefaultLayout()}
+		if _, err := translator.Translate(&asm, files, opts); err != nil {
+			t.Fatal(err)
+		}
+		ram, err := (&vmtest.Script{Cycles: 10000}).RunHack(asm.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ram[5] != 5 {
+			t.Errorf("stack check %v: temp 0 = %d, want 5", stackCheck, ram[5])
+		}
+	}
+}
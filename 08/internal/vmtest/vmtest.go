@@ -0,0 +1,292 @@
+// Package vmtest runs the test programs of projects 7 and 8 the way their
+// CPU emulator scripts do and compares the results with the .cmp files.
+package vmtest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/youchann/nand2tetris/06/assembler"
+	"github.com/youchann/nand2tetris/08/callgraph"
+	"github.com/youchann/nand2tetris/08/codewriter"
+	"github.com/youchann/nand2tetris/08/token"
+	"github.com/youchann/nand2tetris/08/translator"
+)
+
+// Roots are the directories of the project 7 and 8 test programs, relative
+// to the packages of the VM translator.
+var Roots = []string{"../../07/tests", "../tests"}
+
+// Assignment is a "set RAM[Address] Value" line of a test script.
+type Assignment struct {
+	Address int
+	Value   int
+}
+
+// Script is a test program together with what its .tst script does: the
+// RAM it sets up, the number of cycles it runs and the addresses it
+// compares with the .cmp file.
+type Script struct {
+	Name    string
+	Dir     string
+	Setup   []Assignment
+	Cycles  int
+	Outputs []int
+	Want    []int16
+}
+
+var (
+	setPattern    = regexp.MustCompile(`set\s+RAM\[(\d+)\]\s+(-?\d+)`)
+	repeatPattern = regexp.MustCompile(`repeat\s+(\d+)`)
+	outputPattern = regexp.MustCompile(`output-list([^;]*);`)
+	ramPattern    = regexp.MustCompile(`RAM\[(\d+)\]`)
+)
+
+// Load reads the test script in dir, which is named after the directory.
+func Load(dir string) (*Script, error) {
+	name := filepath.Base(dir)
+	tst, err := os.ReadFile(filepath.Join(dir, name+".tst"))
+	if err != nil {
+		return nil, err
+	}
+	cmp, err := os.ReadFile(filepath.Join(dir, name+".cmp"))
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(tst), "\n") {
+		if idx := strings.Index(line, "//"); idx != -1 {
+			line = line[:idx]
+		}
+		lines = append(lines, line)
+	}
+	script := strings.Join(lines, "\n")
+
+	s := &Script{Name: name, Dir: dir}
+	for _, m := range setPattern.FindAllStringSubmatch(script, -1) {
+		address, _ := strconv.Atoi(m[1])
+		value, _ := strconv.Atoi(m[2])
+		s.Setup = append(s.Setup, Assignment{address, value})
+	}
+	m := repeatPattern.FindStringSubmatch(script)
+	if m == nil {
+		return nil, fmt.Errorf("%s.tst: no repeat loop", name)
+	}
+	s.Cycles, _ = strconv.Atoi(m[1])
+	m = outputPattern.FindStringSubmatch(script)
+	if m == nil {
+		return nil, fmt.Errorf("%s.tst: no output list", name)
+	}
+	for _, r := range ramPattern.FindAllStringSubmatch(m[1], -1) {
+		address, _ := strconv.Atoi(r[1])
+		s.Outputs = append(s.Outputs, address)
+	}
+
+	// The header of a .cmp file truncates long column names, so only the
+	// values on its second line are used.
+	cmpLines := strings.Split(strings.ReplaceAll(string(cmp), "\r", ""), "\n")
+	if len(cmpLines) < 2 {
+		return nil, fmt.Errorf("%s.cmp: no values", name)
+	}
+	for _, field := range strings.Split(strings.Trim(strings.TrimSpace(cmpLines[1]), "|"), "|") {
+		value, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("%s.cmp: %w", name, err)
+		}
+		s.Want = append(s.Want, int16(value))
+	}
+	if len(s.Want) != len(s.Outputs) {
+		return nil, fmt.Errorf("%s: %d outputs but %d expected values", name, len(s.Outputs), len(s.Want))
+	}
+	return s, nil
+}
+
+// Files parses the .vm files of the test program in name order.
+func (s *Script) Files() ([]token.File, error) {
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*.vm"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var files []token.File
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		file, err := translator.ParseFile(strings.TrimSuffix(filepath.Base(path), ".vm"), string(content))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// Check compares the output addresses of ram with the .cmp file.
+func (s *Script) Check(ram []int16) error {
+	var mismatches []string
+	for i, address := range s.Outputs {
+		if ram[address] != s.Want[i] {
+			mismatches = append(mismatches, fmt.Sprintf("RAM[%d] = %d, want %d", address, ram[address], s.Want[i]))
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%s: %s", s.Name, strings.Join(mismatches, ", "))
+	}
+	return nil
+}
+
+// Run translates files with opts, runs the program on a Hack CPU and
+// compares the result with the .cmp file.
+func (s *Script) Run(files []token.File, opts codewriter.Options) error {
+	var asm strings.Builder
+	if _, err := translator.Translate(&asm, files, opts); err != nil {
+		return err
+	}
+	ram, err := s.RunHack(asm.String())
+	if err != nil {
+		return err
+	}
+	return s.Check(ram)
+}
+
+// RunHack assembles asm, sets up RAM like the script and runs the program
+// on a Hack CPU for the script's number of cycles, or until it leaves the
+// ROM. It returns the resulting RAM.
+func (s *Script) RunHack(asm string) ([]int16, error) {
+	machineCode, _, _, err := assembler.Assemble(asm)
+	if err != nil {
+		return nil, err
+	}
+	rom := make([]uint16, len(machineCode))
+	for i, word := range machineCode {
+		instruction, err := strconv.ParseUint(word, 2, 16)
+		if err != nil {
+			return nil, fmt.Errorf("ROM[%d]: %w", i, err)
+		}
+		rom[i] = uint16(instruction)
+	}
+
+	ram := make([]int16, 32768)
+	for _, a := range s.Setup {
+		ram[a.Address] = int16(a.Value)
+	}
+	var a, d int16
+	pc := 0
+	for cycle := 0; cycle < s.Cycles && pc < len(rom); cycle++ {
+		instruction := rom[pc]
+		pc++
+		if instruction&0x8000 == 0 {
+			a = int16(instruction)
+			continue
+		}
+		address := int(uint16(a))
+		usesM := instruction&0x1000 != 0
+		writesM := instruction&0x0008 != 0
+		if (usesM || writesM) && address >= len(ram) {
+			return nil, fmt.Errorf("ROM[%d]: RAM address %d out of range", pc-1, address)
+		}
+		y := a
+		if usesM {
+			y = ram[address]
+		}
+		out := alu(d, y, instruction>>6&0x3f)
+		if writesM {
+			ram[address] = out
+		}
+		jump := instruction & 0x7
+		if jump&4 != 0 && out < 0 || jump&2 != 0 && out == 0 || jump&1 != 0 && out > 0 {
+			pc = address
+		}
+		if instruction&0x0020 != 0 {
+			a = out
+		}
+		if instruction&0x0010 != 0 {
+			d = out
+		}
+	}
+	return ram, nil
+}
+
+// alu computes the Hack ALU function selected by the six control bits
+// zx, nx, zy, ny, f and no.
+func alu(x, y int16, control uint16) int16 {
+	if control&0x20 != 0 {
+		x = 0
+	}
+	if control&0x10 != 0 {
+		x = ^x
+	}
+	if control&0x08 != 0 {
+		y = 0
+	}
+	if control&0x04 != 0 {
+		y = ^y
+	}
+	var out int16
+	if control&0x02 != 0 {
+		out = x + y
+	} else {
+		out = x & y
+	}
+	if control&0x01 != 0 {
+		out = ^out
+	}
+	return out
+}
+
+// Dirs returns the test program directories below each of roots.
+func Dirs(roots ...string) ([]string, error) {
+	var dirs []string
+	for _, root := range roots {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				dirs = append(dirs, filepath.Join(root, entry.Name()))
+			}
+		}
+	}
+	return dirs, nil
+}
+
+// Layout returns the default layout with the bootstrap only if files define
+// its entry function, like the translator's auto mode.
+func Layout(files []token.File) codewriter.Layout {
+	layout := codewriter.DefaultLayout()
+	layout.Bootstrap = callgraph.New(files).Function(layout.Entry) != nil
+	return layout
+}
+
+// ForEach calls f in a subtest for each test program below roots, with the
+// program's script and parsed files.
+func ForEach(t *testing.T, roots []string, f func(t *testing.T, s *Script, files []token.File)) {
+	t.Helper()
+	dirs, err := Dirs(roots...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range dirs {
+		s, err := Load(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(s.Name, func(t *testing.T) {
+			files, err := s.Files()
+			if err != nil {
+				t.Fatal(err)
+			}
+			f(t, s, files)
+		})
+	}
+}
@@ -1,23 +1,51 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/youchann/nand2tetris/08/bytecode"
+	"github.com/youchann/nand2tetris/08/callgraph"
 	"github.com/youchann/nand2tetris/08/codewriter"
-	"github.com/youchann/nand2tetris/08/parser"
+	"github.com/youchann/nand2tetris/08/inliner"
+	"github.com/youchann/nand2tetris/08/stackdepth"
 	"github.com/youchann/nand2tetris/08/token"
+	"github.com/youchann/nand2tetris/08/translator"
+	"github.com/youchann/nand2tetris/vmir"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: go run main.go [filename.vm or directory]")
+	optimize := flag.Bool("optimize", false, "share call, return and comparison routines to reduce ROM size")
+	peephole := flag.Bool("peephole", false, "fuse common command sequences before code generation")
+	annotate := flag.Bool("annotate", false, "comment each VM command in the output and write a source map")
+	dce := flag.Bool("dce", false, "drop functions that are unreachable from the entry function")
+	statics := flag.Bool("statics", false, "print the static variable allocation of each file")
+	inline := flag.Int("inline", 0, "inline functions whose body has at most `n` commands (0 disables inlining)")
+	stackDepth := flag.Bool("stack-depth", false, "print a bound on the stack words each function needs, including the functions it calls")
+	check := flag.Bool("check", false, "trap on stack overflow and on pops below the current frame at run time")
+	target := flag.String("target", "hack", "output: hack for Hack assembly (.asm), go for a Go program (.go), vmb for bytecode or vm for text next to each input")
+	layout := codewriter.DefaultLayout()
+	bootstrap := flag.String("bootstrap", "auto", "emit the bootstrap: auto (if the entry function exists), on or off")
+	flag.IntVar(&layout.StackBase, "stack-base", layout.StackBase, "initial stack pointer set by the bootstrap")
+	flag.StringVar(&layout.Entry, "entry", layout.Entry, "function called by the bootstrap")
+	flag.IntVar(&layout.TempBase, "temp-base", layout.TempBase, "address of temp 0")
+	flag.IntVar(&layout.StackLimit, "stack-limit", layout.StackLimit, "highest stack pointer allowed by -check")
+	flag.IntVar(&layout.StaticBase, "static-base", layout.StaticBase, "address of the first static variable (0 lets the assembler allocate them)")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Println("Usage: go run main.go [flags] [filename.vm, filename.vmb or directory]")
+		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
-	path := os.Args[1]
+	path := flag.Arg(0)
 	var vmFiles []string
 
 	fileInfo, err := os.Stat(path)
@@ -32,18 +60,27 @@ func main() {
 			fmt.Fprintf(os.Stderr, "Error reading directory: %v\n", err)
 			os.Exit(1)
 		}
+		seen := map[string]string{}
 		for _, entry := range entries {
-			if filepath.Ext(entry.Name()) == ".vm" {
-				vmFiles = append(vmFiles, filepath.Join(path, entry.Name()))
+			ext := filepath.Ext(entry.Name())
+			if ext != ".vm" && ext != ".vmb" {
+				continue
 			}
+			name := strings.TrimSuffix(entry.Name(), ext)
+			if other, ok := seen[name]; ok {
+				fmt.Fprintf(os.Stderr, "Error: both %s and %s found in directory\n", other, entry.Name())
+				os.Exit(1)
+			}
+			seen[name] = entry.Name()
+			vmFiles = append(vmFiles, filepath.Join(path, entry.Name()))
 		}
 		if len(vmFiles) == 0 {
-			fmt.Fprintf(os.Stderr, "Error: No .vm files found in directory\n")
+			fmt.Fprintf(os.Stderr, "Error: No .vm or .vmb files found in directory\n")
 			os.Exit(1)
 		}
 	} else {
-		if filepath.Ext(path) != ".vm" {
-			fmt.Fprintf(os.Stderr, "Error: File must have .vm extension\n")
+		if ext := filepath.Ext(path); ext != ".vm" && ext != ".vmb" {
+			fmt.Fprintf(os.Stderr, "Error: File must have .vm or .vmb extension\n")
 			os.Exit(1)
 		}
 		vmFiles = append(vmFiles, path)
@@ -51,39 +88,328 @@ func main() {
 
 	outputPath := filepath.Join(
 		filepath.Dir(path),
-		strings.TrimSuffix(fileInfo.Name(), ".vm")+".asm",
+		strings.TrimSuffix(strings.TrimSuffix(fileInfo.Name(), ".vmb"), ".vm")+".asm",
 	)
 
-	c := codewriter.New()
-	defer c.Close(outputPath)
-	for _, filename := range vmFiles {
-		content, err := os.ReadFile(filename)
+	files, err := parseFiles(vmFiles)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *target == "vmb" || *target == "vm" {
+		for i, file := range files {
+			if err := convertFile(vmFiles[i], file, *target); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		return
+	}
+
+	entryDefined := callgraph.New(files).Function(layout.Entry) != nil
+	switch *bootstrap {
+	case "auto":
+		layout.Bootstrap = entryDefined
+		if !entryDefined {
+			fmt.Fprintf(os.Stderr, "Warning: %s is not defined, translating without the bootstrap\n", layout.Entry)
+		}
+	case "on":
+		layout.Bootstrap = true
+		if !entryDefined {
+			fmt.Fprintf(os.Stderr, "Warning: bootstrap calls %s, which is not defined\n", layout.Entry)
+		}
+	case "off":
+		layout.Bootstrap = false
+	default:
+		fmt.Fprintf(os.Stderr, "Error: -bootstrap must be auto, on or off\n")
+		os.Exit(1)
+	}
+
+	if *stackDepth {
+		printStackDepth(stackdepth.Analyze(files), layout)
+	}
+
+	if *target == "go" {
+		hackOnly := map[string]bool{"optimize": true, "peephole": true, "annotate": true, "statics": true, "inline": true, "check": true}
+		flag.Visit(func(f *flag.Flag) {
+			if hackOnly[f.Name] {
+				fmt.Fprintf(os.Stderr, "Error: -%s only applies to -target hack\n", f.Name)
+				os.Exit(1)
+			}
+		})
+		if *dce && entryDefined {
+			files, _ = callgraph.EliminateDeadFunctions(files, layout.Entry)
+		}
+		goPath := strings.TrimSuffix(outputPath, ".asm") + ".go"
+		if err := translateToGo(goPath, files, layout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	} else if *target != "hack" {
+		fmt.Fprintf(os.Stderr, "Error: -target must be hack, go, vmb or vm\n")
+		os.Exit(1)
+	}
+
+	opts := codewriter.Options{SharedRoutines: *optimize, Annotate: *annotate, StackCheck: *check, Layout: layout}
+	if *inline > 0 {
+		var inlined []string
+		romSize := func(files []token.File) (int, error) {
+			if *peephole {
+				files = translator.Optimize(files)
+			}
+			if *dce && entryDefined {
+				files, _ = callgraph.EliminateDeadFunctions(files, layout.Entry)
+			}
+			c, err := translator.Translate(io.Discard, files, opts)
+			if err != nil {
+				return 0, err
+			}
+			return c.ROMSize(), nil
+		}
+		files, inlined, err = inlineWithinROM(files, *inline, romSize)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", filename, err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-		c.Setfilename(strings.TrimSuffix(filepath.Base(filename), ".vm"))
-		p := parser.New(string(content))
-		for p.HasMoreLines() {
-			switch p.CommandType() {
-			case token.C_ARITHMETIC:
-				c.WriteArithmetic(token.CommandSymbol(p.Arg1()))
-			case token.C_PUSH, token.C_POP:
-				c.WritePushPop(p.CommandType(), token.Segment(p.Arg1()), p.Arg2())
-			case token.C_LABEL:
-				c.WriteLabel(p.Arg1())
-			case token.C_GOTO:
-				c.WriteGoto(p.Arg1())
-			case token.C_IF:
-				c.WriteIf(p.Arg1())
-			case token.C_FUNCTION:
-				c.WriteFunction(p.Arg1(), p.Arg2())
-			case token.C_RETURN:
-				c.WriteReturn()
-			case token.C_CALL:
-				c.WriteCall(p.Arg1(), p.Arg2())
+		fmt.Printf("Inlined %d functions\n", len(inlined))
+		for _, name := range inlined {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+	if *peephole {
+		files = translator.Optimize(files)
+	}
+
+	var removed []*callgraph.Function
+	var fullROMSize int
+	if *dce {
+		if !entryDefined {
+			fmt.Fprintf(os.Stderr, "Warning: %s is not defined, keeping all functions\n", layout.Entry)
+		} else {
+			full, err := translator.Translate(io.Discard, files, opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
 			}
-			p.Advance()
+			fullROMSize = full.ROMSize()
+			files, removed = callgraph.EliminateDeadFunctions(files, layout.Entry)
+		}
+	}
+
+	c, err := translateToFile(outputPath, files, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *statics {
+		printStaticAllocation(c.Statics())
+	}
+	if err := c.CheckStatics(); err != nil {
+		os.Remove(outputPath)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *annotate {
+		sourceMapPath := strings.TrimSuffix(outputPath, ".asm") + ".map.json"
+		if err := writeSourceMap(sourceMapPath, c.SourceMap()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing source map: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *check {
+		trapsPath := strings.TrimSuffix(outputPath, ".asm") + ".traps"
+		if err := writeTrapFunctions(trapsPath, c.TrapFunctions()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing trap table: %v\n", err)
+			os.Exit(1)
 		}
+		fmt.Printf("Traps store the error code at RAM %d and the function index at RAM %d\n", layout.TrapCodeAddress(), layout.TrapFunctionAddress())
+	}
+	if *dce && fullROMSize > 0 {
+		fmt.Printf("Removed %d unreachable functions, saving %d ROM words\n", len(removed), fullROMSize-c.ROMSize())
+		for _, f := range removed {
+			fmt.Printf("  %s (%s.vm)\n", f.Name, f.File)
+		}
+	}
+	if *optimize {
+		fmt.Printf("ROM size: %d words\n", c.ROMSize())
+	}
+}
+
+// parseFiles reads and parses vmFiles concurrently and returns them in the
+// same order.
+func parseFiles(vmFiles []string) ([]token.File, error) {
+	files := make([]token.File, len(vmFiles))
+	errs := make([]error, len(vmFiles))
+	var wg sync.WaitGroup
+	for i, filename := range vmFiles {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			content, err := os.ReadFile(filename)
+			if err != nil {
+				errs[i] = fmt.Errorf("reading file %s: %w", filename, err)
+				return
+			}
+			files[i], err = translator.ReadFile(strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)), content)
+			if err != nil && bytecode.IsBytecode(content) {
+				// Parse errors of text files already name the file and line.
+				err = fmt.Errorf("%s: %w", filename, err)
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// inlineWithinROM inlines functions of up to maxCommands commands, lowering
+// the limit until the program, as measured by romSize, fits in ROM or at
+// least does not grow past the size it has without inlining.
+func inlineWithinROM(files []token.File, maxCommands int, romSize func([]token.File) (int, error)) ([]token.File, []string, error) {
+	limit, err := romSize(files)
+	if err != nil {
+		return nil, nil, err
+	}
+	limit = max(limit, codewriter.ROMCapacity)
+	for n := maxCommands; n > 0; n-- {
+		inlined, names := inliner.Inline(files, n)
+		size, err := romSize(inlined)
+		if err != nil {
+			return nil, nil, err
+		}
+		if size <= limit {
+			return inlined, names, nil
+		}
+	}
+	return files, nil, nil
+}
+
+// translateToFile writes the assembly for files to outputPath and returns
+// the closed CodeWriter. The output file is removed if translation fails.
+func translateToFile(outputPath string, files []token.File, opts codewriter.Options) (c *codewriter.CodeWriter, err error) {
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s: %w", outputPath, err)
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("writing %s: %w", outputPath, cerr)
+		}
+		if err != nil {
+			os.Remove(outputPath)
+		}
+	}()
+	return translator.Translate(out, files, opts)
+}
+
+// translateToGo writes files as a Go program to outputPath. The output file
+// is removed if translation fails.
+func translateToGo(outputPath string, files []token.File, layout codewriter.Layout) (err error) {
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", outputPath, err)
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("writing %s: %w", outputPath, cerr)
+		}
+		if err != nil {
+			os.Remove(outputPath)
+		}
+	}()
+	return translator.TranslateToGo(out, files, layout)
+}
+
+// convertFile writes file next to inputPath as bytecode (.vmb) or as text
+// (.vm), depending on target.
+func convertFile(inputPath string, file token.File, target string) error {
+	outputPath := strings.TrimSuffix(inputPath, filepath.Ext(inputPath)) + "." + target
+	if outputPath == inputPath {
+		return fmt.Errorf("%s is already in %s form", inputPath, target)
+	}
+	var content []byte
+	if target == "vmb" {
+		encoded, err := bytecode.Encode(file.IR())
+		if err != nil {
+			return fmt.Errorf("%s: %w", inputPath, err)
+		}
+		content = encoded
+	} else {
+		content = []byte(vmir.Format(file.IR()))
+	}
+	return os.WriteFile(outputPath, content, 0644)
+}
+
+func printStaticAllocation(statics []codewriter.StaticVariable) {
+	var files []string
+	count := map[string]int{}
+	first := map[string]int{}
+	last := map[string]int{}
+	for _, v := range statics {
+		if count[v.File] == 0 {
+			files = append(files, v.File)
+			first[v.File] = v.Address
+		}
+		count[v.File]++
+		last[v.File] = v.Address
+	}
+	fmt.Printf("%-20s %7s  %s\n", "File", "Statics", "Addresses")
+	for _, file := range files {
+		fmt.Printf("%-20s %7d  %d-%d\n", file+".vm", count[file], first[file], last[file])
+	}
+	if len(statics) > 0 {
+		fmt.Printf("%-20s %7d  %d-%d\n", "Total", len(statics), statics[0].Address, statics[len(statics)-1].Address)
+	}
+}
+
+// printStackDepth prints the stack bound of each function and, with the
+// bootstrap, whether the program fits between the stack base and the stack
+// limit.
+func printStackDepth(a *stackdepth.Analysis, layout codewriter.Layout) {
+	fmt.Printf("%-30s %6s %7s  %s\n", "Function", "Locals", "Operand", "Depth")
+	for _, f := range a.Functions {
+		depth := strconv.Itoa(f.Depth)
+		if f.Unbounded != "" {
+			depth = "unbounded, " + f.Unbounded
+		}
+		fmt.Printf("%-30s %6d %7d  %s\n", f.Name, f.NumLocals, f.MaxOperand, depth)
+	}
+	entry := a.Function(layout.Entry)
+	if !layout.Bootstrap || entry == nil {
+		return
+	}
+	available := layout.StackLimit - layout.StackBase
+	if entry.Unbounded != "" {
+		fmt.Printf("Stack depth of %s is unbounded, %d words are available\n", entry.Name, available)
+		return
+	}
+	fmt.Printf("Stack depth of %s is at most %d words, %d are available\n", entry.Name, entry.Depth, available)
+	if entry.Depth > available {
+		fmt.Fprintf(os.Stderr, "Warning: the stack may grow past the stack limit %d\n", layout.StackLimit)
+	}
+}
+
+func writeSourceMap(path string, entries []codewriter.SourceMapEntry) error {
+	content, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// writeTrapFunctions writes the function index table that decodes the
+// layout's TrapFunctionAddress after a trap.
+func writeTrapFunctions(path string, functions []string) error {
+	var b strings.Builder
+	b.WriteString("0\t(outside functions)\n")
+	for i, name := range functions {
+		fmt.Fprintf(&b, "%d\t%s\n", i+1, name)
 	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
 }
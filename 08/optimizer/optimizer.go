@@ -0,0 +1,59 @@
+package optimizer
+
+import (
+	"github.com/youchann/nand2tetris/08/token"
+	"github.com/youchann/nand2tetris/vmir"
+)
+
+// Optimize fuses common command sequences into single commands that the
+// CodeWriter can translate without going through the stack. Only adjacent
+// commands are fused, so a label in between always prevents fusion. A fused
+// command keeps the position of its first part for error messages.
+func Optimize(commands []token.Command) []token.Command {
+	var result []token.Command
+	for i := 0; i < len(commands); {
+		fused, n := fuse(commands[i:])
+		result = append(result, fused)
+		i += n
+	}
+	return result
+}
+
+func fuse(commands []token.Command) (token.Command, int) {
+	first := commands[0]
+	if first.Op == token.INLINE {
+		first.Parts = Optimize(first.Parts)
+		return first, 1
+	}
+	if len(commands) >= 3 && isCompare(first) && commands[1].Op == vmir.Not && commands[2].Op == vmir.IfGoto {
+		return fused(token.COMPARE_IF, commands[2].Name, commands[:3]), 3
+	}
+	if len(commands) < 2 {
+		return first, 1
+	}
+	second := commands[1]
+	switch {
+	case first.Op == vmir.Push && second.Op == vmir.Pop:
+		return fused(token.MOVE, "", commands[:2]), 2
+	case isPushConstant(first, 0) && second.Op == vmir.Not,
+		isPushConstant(first, 1) && second.Op == vmir.Neg:
+		return fused(token.PUSH_TRUE, "", commands[:2]), 2
+	case isCompare(first) && second.Op == vmir.IfGoto:
+		return fused(token.COMPARE_IF, second.Name, commands[:2]), 2
+	case first.Op == vmir.Not && second.Op == vmir.IfGoto:
+		return fused(token.IF_NOT, second.Name, commands[:2]), 2
+	}
+	return first, 1
+}
+
+func fused(op token.CommandSymbol, name string, parts []token.Command) token.Command {
+	return token.Command{Command: vmir.Command{Op: op, Name: name, Pos: parts[0].Pos}, Parts: parts}
+}
+
+func isCompare(command token.Command) bool {
+	return command.Op == vmir.Eq || command.Op == vmir.Gt || command.Op == vmir.Lt
+}
+
+func isPushConstant(command token.Command, value int) bool {
+	return command.Op == vmir.Push && command.Segment == vmir.Constant && command.Index == value
+}
@@ -0,0 +1,50 @@
+package optimizer_test
+
+import (
+	"testing"
+
+	"github.com/youchann/nand2tetris/08/codewriter"
+	"github.com/youchann/nand2tetris/08/internal/vmtest"
+	"github.com/youchann/nand2tetris/08/optimizer"
+	"github.com/youchann/nand2tetris/08/token"
+	"github.com/youchann/nand2tetris/08/translator"
+)
+
+// TestPreservesBehavior runs the project 7 and 8 test programs with and
+// without the optimizer and compares both runs with the .cmp files.
+func TestPreservesBehavior(t *testing.T) {
+	vmtest.ForEach(t, vmtest.Roots, func(t *testing.T, s *vmtest.Script, files []token.File) {
+		opts := codewriter.Options{Layout: vmtest.Layout(files)}
+		if err := s.Run(files, opts); err != nil {
+			t.Errorf("without optimizer: %v", err)
+		}
+		if err := s.Run(translator.Optimize(files), opts); err != nil {
+			t.Errorf("with optimizer: %v", err)
+		}
+	})
+}
+
+func TestFusedCommandsKeepLine(t *testing.T) {
+	file, err := translator.ParseFile("Main", "push local 0\npop local 1\npush constant 0\nnot\nlt\nif-goto END\nlabel END\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fused := optimizer.Optimize(file.Commands)
+	want := []struct {
+		op   token.CommandSymbol
+		line int
+	}{
+		{token.MOVE, 1},
+		{token.PUSH_TRUE, 3},
+		{token.COMPARE_IF, 5},
+		{token.LABEL, 7},
+	}
+	if len(fused) != len(want) {
+		t.Fatalf("got %d commands, want %d", len(fused), len(want))
+	}
+	for i, w := range want {
+		if fused[i].Op != w.op || fused[i].Pos.Line != w.line {
+			t.Errorf("command %d: got %s at line %d, want %s at line %d", i, fused[i].Op, fused[i].Pos.Line, w.op, w.line)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Package stackdepth bounds the stack space VM functions need.
+//
+// The operand stack of a function is followed through every branch from the
+// stack effect of each command. A call needs the words on the caller's stack
+// at the call, which include the arguments, plus the callee's frame: the
+// return address, the four saved pointers, the locals and whatever the
+// callee needs in turn.
+package stackdepth
+
+import (
+	"strings"
+
+	"github.com/youchann/nand2tetris/08/callgraph"
+	"github.com/youchann/nand2tetris/08/token"
+	"github.com/youchann/nand2tetris/vmir"
+)
+
+// FrameSize is the number of words call pushes besides the arguments.
+const FrameSize = 5
+
+type Function struct {
+	Name      string
+	File      string
+	NumLocals int
+	// MaxOperand is the largest number of values on the function's operand
+	// stack, above its locals.
+	MaxOperand int
+	// Depth bounds the words the function uses from the first word of its
+	// frame, including the frames of every function it calls. It is only
+	// meaningful if Unbounded is empty.
+	Depth int
+	// Unbounded says why Depth cannot be bounded, for example because the
+	// function is recursive.
+	Unbounded string
+	calls     []call
+}
+
+// call is a call site and the operand stack depth before it, arguments
+// included.
+type call struct {
+	callee string
+	depth  int
+}
+
+type Analysis struct {
+	Functions []*Function // in source order
+	functions map[string]*Function
+}
+
+// Analyze computes the stack depth of every function in files.
+func Analyze(files []token.File) *Analysis {
+	a := &Analysis{functions: map[string]*Function{}}
+	for _, f := range callgraph.New(files).Functions {
+		function := operandDepth(f)
+		a.Functions = append(a.Functions, function)
+		a.functions[function.Name] = function
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[string]int{}
+	var path []string
+	var visit func(f *Function)
+	visit = func(f *Function) {
+		state[f.Name] = visiting
+		path = append(path, f.Name)
+		deepest := f.MaxOperand
+		for _, c := range f.calls {
+			callee := a.functions[c.callee]
+			if callee == nil {
+				if f.Unbounded == "" {
+					f.Unbounded = "calls undefined function " + c.callee
+				}
+				continue
+			}
+			switch state[callee.Name] {
+			case unvisited:
+				visit(callee)
+			case visiting:
+				start := len(path) - 1
+				for path[start] != callee.Name {
+					start--
+				}
+				cycle := "recursive: " + strings.Join(append(path[start:len(path):len(path)], callee.Name), " -> ")
+				for _, name := range path[start:] {
+					if member := a.functions[name]; member.Unbounded == "" {
+						member.Unbounded = cycle
+					}
+				}
+				continue
+			}
+			if callee.Unbounded != "" {
+				if f.Unbounded == "" {
+					f.Unbounded = "calls " + callee.Name + ", which is unbounded"
+				}
+				continue
+			}
+			deepest = max(deepest, c.depth+callee.Depth)
+		}
+		f.Depth = FrameSize + f.NumLocals + deepest
+		path = path[:len(path)-1]
+		state[f.Name] = done
+	}
+	for _, f := range a.Functions {
+		if state[f.Name] == unvisited {
+			visit(f)
+		}
+	}
+	return a
+}
+
+// Function returns the analysis of the named function, or nil if it is not
+// defined.
+func (a *Analysis) Function(name string) *Function {
+	return a.functions[name]
+}
+
+// operandDepth follows the operand stack of f through its branches and
+// records the depth at each call. A depth above the number of commands can
+// only come from a loop that keeps pushing.
+func operandDepth(f *callgraph.Function) *Function {
+	result := &Function{Name: f.Name, File: f.File, NumLocals: f.Commands[0].Index}
+	commands := f.Commands
+	labels := map[string]int{}
+	for i, command := range commands {
+		if command.Op == vmir.Label {
+			labels[command.Name] = i
+		}
+	}
+
+	depth := make([]int, len(commands)) // before each command, -1 if not reached
+	for i := range depth {
+		depth[i] = -1
+	}
+	calls := map[int]bool{}
+	work := []int{0}
+	depth[0] = 0
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		command := commands[i]
+		after := max(depth[i]+stackEffect(command), 0)
+		result.MaxOperand = max(result.MaxOperand, after)
+		if after > len(commands) {
+			result.Unbounded = "operand stack grows in a loop"
+			return result
+		}
+		if command.Op == vmir.Call {
+			calls[i] = true
+		}
+
+		var next []int
+		if target, ok := labels[command.Name]; ok && (command.Op == vmir.Goto || command.Op == vmir.IfGoto) {
+			next = append(next, target)
+		}
+		if command.Op != vmir.Goto && command.Op != vmir.Return {
+			next = append(next, i+1)
+		}
+		for _, n := range next {
+			if n < len(commands) && after > depth[n] {
+				depth[n] = after
+				work = append(work, n)
+			}
+		}
+	}
+	for i, command := range commands {
+		if calls[i] {
+			result.calls = append(result.calls, call{callee: command.Name, depth: depth[i]})
+		}
+	}
+	return result
+}
+
+// stackEffect returns how many values command leaves on the operand stack
+// minus how many it takes.
+func stackEffect(command token.Command) int {
+	switch command.Op {
+	case vmir.Push:
+		return 1
+	case vmir.Pop, vmir.IfGoto:
+		return -1
+	case vmir.Neg, vmir.Not:
+		return 0
+	case vmir.Add, vmir.Sub, vmir.Eq, vmir.Gt, vmir.Lt, vmir.And, vmir.Or:
+		return -1
+	case vmir.Call:
+		return 1 - command.Index
+	case vmir.Return:
+		return -1
+	}
+	return 0
+}
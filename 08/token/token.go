@@ -1,5 +1,12 @@
 package token
 
+import (
+	"strconv"
+	"strings"
+
+	"github.com/youchann/nand2tetris/vmir"
+)
+
 type CommandType string
 
 const (
@@ -14,37 +21,114 @@ const (
 	C_CALL       CommandType = "C_CALL"
 )
 
-type Segment string
+type Segment = vmir.Segment
 
 const (
-	SEGMENT_LOCAL    Segment = "local"
-	SEGMENT_ARGUMENT Segment = "argument"
-	SEGMENT_THIS     Segment = "this"
-	SEGMENT_THAT     Segment = "that"
-	SEGMENT_POINTER  Segment = "pointer"
-	SEGMENT_TEMP     Segment = "temp"
-	SEGMENT_CONSTANT Segment = "constant"
-	SEGMENT_STATIC   Segment = "static"
+	SEGMENT_LOCAL    = vmir.Local
+	SEGMENT_ARGUMENT = vmir.Argument
+	SEGMENT_THIS     = vmir.This
+	SEGMENT_THAT     = vmir.That
+	SEGMENT_POINTER  = vmir.Pointer
+	SEGMENT_TEMP     = vmir.Temp
+	SEGMENT_CONSTANT = vmir.Constant
+	SEGMENT_STATIC   = vmir.Static
 )
 
-type CommandSymbol string
+type CommandSymbol = vmir.Opcode
+
+const (
+	PUSH     = vmir.Push
+	POP      = vmir.Pop
+	LABEL    = vmir.Label
+	GOTO     = vmir.Goto
+	IF_GOTO  = vmir.IfGoto
+	CALL     = vmir.Call
+	FUNCTION = vmir.Function
+	RETURN   = vmir.Return
+	ADD      = vmir.Add
+	SUB      = vmir.Sub
+	NEG      = vmir.Neg
+	EQ       = vmir.Eq
+	GT       = vmir.Gt
+	LT       = vmir.Lt
+	AND      = vmir.And
+	OR       = vmir.Or
+	NOT      = vmir.Not
+)
 
+// Opcodes of fused commands. The optimizer and the inliner replace
+// sequences of commands with them, and Parts holds the commands they
+// replace. They never appear in .vm files.
 const (
-	PUSH     CommandSymbol = "push"
-	POP      CommandSymbol = "pop"
-	LABEL    CommandSymbol = "label"
-	GOTO     CommandSymbol = "goto"
-	IF_GOTO  CommandSymbol = "if-goto"
-	CALL     CommandSymbol = "call"
-	FUNCTION CommandSymbol = "function"
-	RETURN   CommandSymbol = "return"
-	ADD      CommandSymbol = "add"
-	SUB      CommandSymbol = "sub"
-	NEG      CommandSymbol = "neg"
-	EQ       CommandSymbol = "eq"
-	GT       CommandSymbol = "gt"
-	LT       CommandSymbol = "lt"
-	AND      CommandSymbol = "and"
-	OR       CommandSymbol = "or"
-	NOT      CommandSymbol = "not"
+	MOVE       CommandSymbol = "$move"       // push Parts[0] / pop Parts[1]
+	PUSH_TRUE  CommandSymbol = "$push-true"  // push constant 0 / not, push constant 1 / neg
+	IF_NOT     CommandSymbol = "$if-not"     // not / if-goto Name
+	COMPARE_IF CommandSymbol = "$compare-if" // eq|gt|lt (/ not) / if-goto Name
+	// INLINE replaces "call Name Index". Its Parts are the callee's
+	// commands, from the function command to the return.
+	INLINE CommandSymbol = "$inline"
 )
+
+// Command is a VM command or a fused command. Parts is only set for fused
+// commands.
+type Command struct {
+	vmir.Command
+	Parts []Command
+}
+
+// String returns the command as it is written in a .vm file. Fused commands
+// are written as their parts separated by " / ", except that an inlined
+// call is written as the call.
+func (c Command) String() string {
+	switch c.Op {
+	case INLINE:
+		return string(CALL) + " " + c.Name + " " + strconv.Itoa(c.Index)
+	case MOVE, PUSH_TRUE, IF_NOT, COMPARE_IF:
+		parts := make([]string, len(c.Parts))
+		for i, part := range c.Parts {
+			parts[i] = part.String()
+		}
+		return strings.Join(parts, " / ")
+	default:
+		return c.Command.String()
+	}
+}
+
+// File is a parsed .vm file. Name is the file name without the extension,
+// which also prefixes the file's static variables.
+type File struct {
+	Name     string
+	Commands []Command
+}
+
+// NewFile wraps commands of the shared VM IR into a File.
+func NewFile(name string, commands []vmir.Command) File {
+	file := File{Name: name}
+	for _, c := range commands {
+		file.Commands = append(file.Commands, Command{Command: c})
+	}
+	return file
+}
+
+// IR returns the commands of f in the shared VM IR. Fused commands are
+// replaced with their parts and inlined calls with the calls.
+func (f File) IR() []vmir.Command {
+	var result []vmir.Command
+	var convert func(commands []Command)
+	convert = func(commands []Command) {
+		for _, c := range commands {
+			switch c.Op {
+			case INLINE:
+				call := c.Command
+				call.Op = CALL
+				result = append(result, call)
+			case MOVE, PUSH_TRUE, IF_NOT, COMPARE_IF:
+				convert(c.Parts)
+			default:
+				result = append(result, c.Command)
+			}
+		}
+	}
+	convert(f.Commands)
+	return result
+}
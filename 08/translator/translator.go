@@ -0,0 +1,219 @@
+package translator
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/youchann/nand2tetris/08/bytecode"
+	"github.com/youchann/nand2tetris/08/codewriter"
+	"github.com/youchann/nand2tetris/08/gowriter"
+	"github.com/youchann/nand2tetris/08/optimizer"
+	"github.com/youchann/nand2tetris/08/token"
+	"github.com/youchann/nand2tetris/vmir"
+)
+
+// ParseFile parses the content of a .vm file. name is the file name without
+// the extension.
+func ParseFile(name, content string) (token.File, error) {
+	commands, err := vmir.Parse(name, content)
+	return token.NewFile(name, commands), err
+}
+
+// ReadFile parses the content of a .vm file given either as text or as
+// bytecode, which is recognized by its header.
+func ReadFile(name string, content []byte) (token.File, error) {
+	if bytecode.IsBytecode(content) {
+		commands, err := bytecode.Decode(name, content)
+		return token.NewFile(name, commands), err
+	}
+	return ParseFile(name, string(content))
+}
+
+// Optimize runs the peephole optimizer over every file.
+func Optimize(files []token.File) []token.File {
+	var result []token.File
+	for _, file := range files {
+		result = append(result, token.File{Name: file.Name, Commands: optimizer.Optimize(file.Commands)})
+	}
+	return result
+}
+
+// Translate writes the assembly for files to w and returns the closed
+// CodeWriter. Each file is translated into its own fragment concurrently;
+// the fragments are then joined in file order, so the output does not
+// depend on scheduling.
+func Translate(w io.Writer, files []token.File, opts codewriter.Options) (*codewriter.CodeWriter, error) {
+	c, err := codewriter.New(w, opts)
+	if err != nil {
+		return nil, err
+	}
+	fragments := make([]*codewriter.CodeWriter, len(files))
+	staticOffset, functionOffset := 0, 0
+	for i, file := range files {
+		fragments[i] = c.Fragment(file.Name, staticOffset, functionOffset)
+		staticOffset += countStatics(file.Commands)
+		for _, command := range file.Commands {
+			if command.Op == vmir.Function {
+				functionOffset++
+			}
+		}
+	}
+
+	errs := make([]error, len(files))
+	var wg sync.WaitGroup
+	for i, file := range files {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = translateFile(fragments[i], file)
+		}()
+	}
+	wg.Wait()
+
+	for i := range files {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if err := c.Append(fragments[i]); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Close(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func translateFile(c *codewriter.CodeWriter, file token.File) error {
+	for _, command := range file.Commands {
+		if err := c.WriteSource(command); err != nil {
+			return err
+		}
+		if err := writeCommand(c, command); err != nil {
+			return fmt.Errorf("%s: %w", command.Pos, err)
+		}
+	}
+	return nil
+}
+
+// countStatics returns the number of distinct static variables that
+// commands use, including those inside fused and inlined commands.
+func countStatics(commands []token.Command) int {
+	used := map[int]bool{}
+	var visit func(commands []token.Command)
+	visit = func(commands []token.Command) {
+		for _, command := range commands {
+			if (command.Op == vmir.Push || command.Op == vmir.Pop) && command.Segment == vmir.Static {
+				used[command.Index] = true
+			}
+			visit(command.Parts)
+		}
+	}
+	visit(commands)
+	return len(used)
+}
+
+// TranslateToGo writes files to w as a Go program.
+func TranslateToGo(w io.Writer, files []token.File, layout codewriter.Layout) error {
+	g := gowriter.New(w, layout)
+	for _, file := range files {
+		g.Setfilename(file.Name)
+		for _, command := range file.Commands {
+			if err := writeVMCommand(g, command); err != nil {
+				return fmt.Errorf("%s: %w", command.Pos, err)
+			}
+		}
+	}
+	return g.Close()
+}
+
+// vmWriter is the part of the CodeWriter that every backend implements.
+type vmWriter interface {
+	Setfilename(filename string)
+	WriteArithmetic(command token.CommandSymbol) error
+	WritePushPop(command token.CommandType, segment token.Segment, index int) error
+	WriteLabel(label string) error
+	WriteGoto(label string) error
+	WriteIf(label string) error
+	WriteFunction(functionName string, numLocals int) error
+	WriteReturn() error
+	WriteCall(functionName string, numArgs int) error
+	Close() error
+}
+
+func writeCommand(c *codewriter.CodeWriter, command token.Command) error {
+	switch command.Op {
+	case token.MOVE:
+		push, pop := command.Parts[0], command.Parts[1]
+		return c.WriteMove(push.Segment, push.Index, pop.Segment, pop.Index)
+	case token.PUSH_TRUE:
+		return c.WritePushTrue()
+	case token.IF_NOT:
+		return c.WriteIfNot(command.Name)
+	case token.COMPARE_IF:
+		return c.WriteCompareIf(command.Parts[0].Op, command.Name, len(command.Parts) == 3)
+	case token.INLINE:
+		return writeInline(c, command)
+	default:
+		return writeVMCommand(c, command)
+	}
+}
+
+func writeVMCommand(w vmWriter, command token.Command) error {
+	switch command.Op {
+	case vmir.Push:
+		return w.WritePushPop(token.C_PUSH, command.Segment, command.Index)
+	case vmir.Pop:
+		return w.WritePushPop(token.C_POP, command.Segment, command.Index)
+	case vmir.Label:
+		return w.WriteLabel(command.Name)
+	case vmir.Goto:
+		return w.WriteGoto(command.Name)
+	case vmir.IfGoto:
+		return w.WriteIf(command.Name)
+	case vmir.Function:
+		return w.WriteFunction(command.Name, command.Index)
+	case vmir.Return:
+		return w.WriteReturn()
+	case vmir.Call:
+		return w.WriteCall(command.Name, command.Index)
+	default:
+		if command.Op.IsArithmetic() {
+			return w.WriteArithmetic(command.Op)
+		}
+		return fmt.Errorf("unsupported command %q", command.Op)
+	}
+}
+
+func writeInline(c *codewriter.CodeWriter, command token.Command) error {
+	function := command.Parts[0]
+	body := command.Parts[1 : len(command.Parts)-1]
+	frame := codewriter.InlineFrame{
+		NumArgs:   command.Index,
+		NumLocals: function.Index,
+		SaveThis:  popsPointer(body, 0),
+		SaveThat:  popsPointer(body, 1),
+	}
+	if err := c.WriteInlineEnter(frame); err != nil {
+		return err
+	}
+	for _, part := range body {
+		if err := writeCommand(c, part); err != nil {
+			return err
+		}
+	}
+	return c.WriteInlineReturn()
+}
+
+func popsPointer(commands []token.Command, index int) bool {
+	for _, command := range commands {
+		if command.Op == vmir.Pop && command.Segment == vmir.Pointer && command.Index == index {
+			return true
+		}
+		if popsPointer(command.Parts, index) {
+			return true
+		}
+	}
+	return false
+}
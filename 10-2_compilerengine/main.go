@@ -6,8 +6,9 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/youchann/nand2tetris/10-2_compilerengine/compilationengine"
-	"github.com/youchann/nand2tetris/10-2_compilerengine/tokenizer"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/parser"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/tokenizer"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/xmlwriter"
 )
 
 func getXMLPath(jackFilePath string) string {
@@ -55,6 +56,7 @@ func main() {
 		jackFiles = append(jackFiles, path)
 	}
 
+	failed := false
 	for _, jackFile := range jackFiles {
 		content, err := os.ReadFile(jackFile)
 		if err != nil {
@@ -62,6 +64,14 @@ func main() {
 			os.Exit(1)
 		}
 
+		t := tokenizer.New(filepath.Base(jackFile), string(content))
+		class, err := parser.New(t).ParseClass()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			failed = true
+			continue
+		}
+
 		xmlPath := getXMLPath(jackFile)
 		xmlFile, err := os.Create(xmlPath)
 		if err != nil {
@@ -70,9 +80,11 @@ func main() {
 		}
 		defer xmlFile.Close()
 
-		t := tokenizer.New(string(content))
-		ce := compilationengine.New(t)
-		ce.CompileClass()
-		xmlFile.WriteString(ce.XML)
+		w := xmlwriter.New()
+		class.Accept(w)
+		xmlFile.WriteString(w.XML)
+	}
+	if failed {
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,242 @@
+// Package ast declares the syntax tree of a Jack class. Every node records
+// the position of its first token.
+package ast
+
+import "github.com/youchann/nand2tetris/11-2_vmwriter/token"
+
+type Node interface {
+	Position() token.Position
+	Accept(v Visitor)
+}
+
+type Statement interface {
+	Node
+	statementNode()
+}
+
+type Expression interface {
+	Node
+	expressionNode()
+}
+
+// Visitor has a method for each kind of node. Accept calls the one for its
+// node; visiting the children is up to the method.
+type Visitor interface {
+	VisitClass(n *Class)
+	VisitClassVarDec(n *ClassVarDec)
+	VisitSubroutineDec(n *SubroutineDec)
+
+	VisitLetStatement(n *LetStatement)
+	VisitIfStatement(n *IfStatement)
+	VisitWhileStatement(n *WhileStatement)
+	VisitDoStatement(n *DoStatement)
+	VisitReturnStatement(n *ReturnStatement)
+
+	VisitIntegerConstant(n *IntegerConstant)
+	VisitStringConstant(n *StringConstant)
+	VisitKeywordConstant(n *KeywordConstant)
+	VisitVarName(n *VarName)
+	VisitArrayElement(n *ArrayElement)
+	VisitCallExpression(n *CallExpression)
+	VisitUnaryExpression(n *UnaryExpression)
+	VisitBinaryExpression(n *BinaryExpression)
+	VisitParenExpression(n *ParenExpression)
+}
+
+// Declarations
+
+type Class struct {
+	Pos         token.Position
+	Name        string
+	NamePos     token.Position
+	VarDecs     []*ClassVarDec
+	Subroutines []*SubroutineDec
+	Rbrace      token.Position
+}
+
+type ClassVarDec struct {
+	Pos   token.Position
+	Kind  token.Keyword // static or field
+	Type  string
+	Names []string
+}
+
+type SubroutineDec struct {
+	Pos        token.Position
+	Kind       token.Keyword // constructor, function or method
+	ReturnType string        // a type or void
+	Name       string
+	Params     []*Parameter
+	Body       *SubroutineBody
+}
+
+type Parameter struct {
+	Pos  token.Position
+	Type string
+	Name string
+}
+
+type SubroutineBody struct {
+	Lbrace     token.Position
+	VarDecs    []*VarDec
+	Statements []Statement
+	Rbrace     token.Position
+}
+
+type VarDec struct {
+	Pos   token.Position
+	Type  string
+	Names []string
+}
+
+// Block is a braced list of statements.
+type Block struct {
+	Lbrace     token.Position
+	Statements []Statement
+	Rbrace     token.Position
+}
+
+// Statements
+
+type LetStatement struct {
+	Pos     token.Position
+	Name    string
+	NamePos token.Position
+	Index   Expression // nil unless an array element is assigned
+	Value   Expression
+}
+
+type IfStatement struct {
+	Pos       token.Position
+	Condition Expression
+	Then      *Block
+	Else      *Block // nil without else
+}
+
+type WhileStatement struct {
+	Pos       token.Position
+	Condition Expression
+	Body      *Block
+}
+
+type DoStatement struct {
+	Pos  token.Position
+	Call *CallExpression
+}
+
+type ReturnStatement struct {
+	Pos   token.Position
+	Value Expression // nil in a plain return
+}
+
+// Expressions
+
+type IntegerConstant struct {
+	Pos   token.Position
+	Value int
+}
+
+type StringConstant struct {
+	Pos   token.Position
+	Value string
+}
+
+// KeywordConstant is true, false, null or this.
+type KeywordConstant struct {
+	Pos     token.Position
+	Keyword token.Keyword
+}
+
+type VarName struct {
+	Pos  token.Position
+	Name string
+}
+
+type ArrayElement struct {
+	Pos   token.Position
+	Name  string
+	Index Expression
+}
+
+// CallExpression is a subroutine call. Receiver is the class or variable
+// before the dot, or empty for a method call on this object.
+type CallExpression struct {
+	Pos      token.Position
+	Receiver string
+	Name     string
+	NamePos  token.Position
+	Args     []Expression
+}
+
+// UnaryExpression is -x or ~x.
+type UnaryExpression struct {
+	Pos     token.Position
+	Op      token.Symbol
+	Operand Expression
+}
+
+// BinaryExpression is x op y. Jack has no operator precedence, so a chain of
+// operators nests to the left and Right is never a BinaryExpression.
+type BinaryExpression struct {
+	Left  Expression
+	OpPos token.Position
+	Op    token.Symbol
+	Right Expression
+}
+
+type ParenExpression struct {
+	Pos        token.Position
+	Expression Expression
+}
+
+func (n *Class) Position() token.Position            { return n.Pos }
+func (n *ClassVarDec) Position() token.Position      { return n.Pos }
+func (n *SubroutineDec) Position() token.Position    { return n.Pos }
+func (n *LetStatement) Position() token.Position     { return n.Pos }
+func (n *IfStatement) Position() token.Position      { return n.Pos }
+func (n *WhileStatement) Position() token.Position   { return n.Pos }
+func (n *DoStatement) Position() token.Position      { return n.Pos }
+func (n *ReturnStatement) Position() token.Position  { return n.Pos }
+func (n *IntegerConstant) Position() token.Position  { return n.Pos }
+func (n *StringConstant) Position() token.Position   { return n.Pos }
+func (n *KeywordConstant) Position() token.Position  { return n.Pos }
+func (n *VarName) Position() token.Position          { return n.Pos }
+func (n *ArrayElement) Position() token.Position     { return n.Pos }
+func (n *CallExpression) Position() token.Position   { return n.Pos }
+func (n *UnaryExpression) Position() token.Position  { return n.Pos }
+func (n *BinaryExpression) Position() token.Position { return n.Left.Position() }
+func (n *ParenExpression) Position() token.Position  { return n.Pos }
+
+func (n *Class) Accept(v Visitor)            { v.VisitClass(n) }
+func (n *ClassVarDec) Accept(v Visitor)      { v.VisitClassVarDec(n) }
+func (n *SubroutineDec) Accept(v Visitor)    { v.VisitSubroutineDec(n) }
+func (n *LetStatement) Accept(v Visitor)     { v.VisitLetStatement(n) }
+func (n *IfStatement) Accept(v Visitor)      { v.VisitIfStatement(n) }
+func (n *WhileStatement) Accept(v Visitor)   { v.VisitWhileStatement(n) }
+func (n *DoStatement) Accept(v Visitor)      { v.VisitDoStatement(n) }
+func (n *ReturnStatement) Accept(v Visitor)  { v.VisitReturnStatement(n) }
+func (n *IntegerConstant) Accept(v Visitor)  { v.VisitIntegerConstant(n) }
+func (n *StringConstant) Accept(v Visitor)   { v.VisitStringConstant(n) }
+func (n *KeywordConstant) Accept(v Visitor)  { v.VisitKeywordConstant(n) }
+func (n *VarName) Accept(v Visitor)          { v.VisitVarName(n) }
+func (n *ArrayElement) Accept(v Visitor)     { v.VisitArrayElement(n) }
+func (n *CallExpression) Accept(v Visitor)   { v.VisitCallExpression(n) }
+func (n *UnaryExpression) Accept(v Visitor)  { v.VisitUnaryExpression(n) }
+func (n *BinaryExpression) Accept(v Visitor) { v.VisitBinaryExpression(n) }
+func (n *ParenExpression) Accept(v Visitor)  { v.VisitParenExpression(n) }
+
+func (*LetStatement) statementNode()    {}
+func (*IfStatement) statementNode()     {}
+func (*WhileStatement) statementNode()  {}
+func (*DoStatement) statementNode()     {}
+func (*ReturnStatement) statementNode() {}
+
+func (*IntegerConstant) expressionNode()  {}
+func (*StringConstant) expressionNode()   {}
+func (*KeywordConstant) expressionNode()  {}
+func (*VarName) expressionNode()          {}
+func (*ArrayElement) expressionNode()     {}
+func (*CallExpression) expressionNode()   {}
+func (*UnaryExpression) expressionNode()  {}
+func (*BinaryExpression) expressionNode() {}
+func (*ParenExpression) expressionNode()  {}
@@ -1,9 +1,11 @@
 package compilationengine
 
 import (
-	"slices"
 	"strconv"
+	"strings"
 
+	"github.com/youchann/nand2tetris/11-2_vmwriter/ast"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/parser"
 	"github.com/youchann/nand2tetris/11-2_vmwriter/symboltable"
 	"github.com/youchann/nand2tetris/11-2_vmwriter/token"
 	"github.com/youchann/nand2tetris/11-2_vmwriter/tokenizer"
@@ -17,6 +19,7 @@ var kindSegmentMap = map[symboltable.Kind]vmwriter.Segment{
 	symboltable.VAR_LOCAL: vmwriter.LOCAL,
 }
 
+// CompilationEngine generates the VM code of a class as an ast.Visitor.
 type CompilationEngine struct {
 	className    string
 	labelCount   int
@@ -24,6 +27,10 @@ type CompilationEngine struct {
 	vmwriter     *vmwriter.VMWriter
 	classST      *symboltable.SymbolTable
 	subroutineST *symboltable.SymbolTable
+	emitComments bool
+	// source locates the statement or subroutine being compiled.
+	source token.Position
+	errors parser.ErrorList
 }
 
 func New(n string, t *tokenizer.JackTokenizer, w *vmwriter.VMWriter) *CompilationEngine {
@@ -34,464 +41,286 @@ func New(n string, t *tokenizer.JackTokenizer, w *vmwriter.VMWriter) *Compilatio
 		vmwriter:     w,
 		classST:      symboltable.New(),
 		subroutineST: symboltable.New(),
+		emitComments: false,
+		source:       token.Position{},
+		errors:       nil,
 	}
 }
 
-func (ce *CompilationEngine) CompileClass() {
-	ce.process("class")
+// SetEmitComments makes the engine write a comment with the Jack source line
+// before the VM code of each statement.
+func (ce *CompilationEngine) SetEmitComments(on bool) {
+	ce.emitComments = on
+}
 
-	// className
-	name := ce.tokenizer.CurrentToken().Literal
-	if ce.tokenizer.CurrentToken().Type != token.IDENTIFIER {
-		panic("expected identifier but got " + name)
-	} else if name != ce.className {
-		panic("class name does not match file name")
+// CompileClass parses the class and writes its VM code. It returns the
+// syntax errors of the class, or else the errors found while compiling it,
+// as a parser.ErrorList.
+func (ce *CompilationEngine) CompileClass() error {
+	class, err := parser.New(ce.tokenizer).ParseClass()
+	if err != nil {
+		return err
 	}
-	ce.tokenizer.Advance()
-
-	ce.process("{")
-	ce.compileClassVarDec()
-	ce.compileSubroutine()
-	ce.process("}")
+	class.Accept(ce)
+	if len(ce.errors) > 0 {
+		return ce.errors
+	}
+	return nil
 }
 
-func (ce *CompilationEngine) compileClassVarDec() {
-	for ce.tokenizer.CurrentToken().Literal == "static" || ce.tokenizer.CurrentToken().Literal == "field" {
-		// static or field
-		kind := ce.process(ce.tokenizer.CurrentToken().Literal)
-		// type
-		typ := ce.processType()
-
-		// varName
-		for ce.tokenizer.CurrentToken().Literal != ";" {
-			name := ce.tokenizer.CurrentToken().Literal
-			if ce.tokenizer.CurrentToken().Type != token.IDENTIFIER {
-				panic("expected identifier but got " + name)
-			}
-			ce.classST.Define(name, typ, symboltable.KindMap[kind])
-			ce.tokenizer.Advance()
-			if ce.tokenizer.CurrentToken().Literal == "," {
-				ce.process(",")
-			}
-		}
-
-		ce.process(";")
+func (ce *CompilationEngine) VisitClass(n *ast.Class) {
+	if n.Name != ce.className {
+		ce.errors.Add(n.NamePos, "class name does not match file name")
+	}
+	for _, dec := range n.VarDecs {
+		dec.Accept(ce)
+	}
+	for _, dec := range n.Subroutines {
+		dec.Accept(ce)
 	}
 }
 
-func (ce *CompilationEngine) compileSubroutine() {
-	subroutineType := []token.Keyword{token.CONSTRUCTOR, token.FUNCTION, token.METHOD}
-	for slices.Contains(subroutineType, token.Keyword(ce.tokenizer.CurrentToken().Literal)) {
-		ce.subroutineST.Reset()
-
-		// constructor, function, or method
-		methodType := ce.tokenizer.CurrentToken().Literal
-		ce.process(methodType)
-
-		// void or type
-		voidOrType := []token.Keyword{token.VOID, token.INT, token.CHAR, token.BOOLEAN}
-		if !slices.Contains(voidOrType, token.Keyword(ce.tokenizer.CurrentToken().Literal)) && ce.tokenizer.CurrentToken().Type != token.IDENTIFIER {
-			panic("expected type or void but got " + ce.tokenizer.CurrentToken().Literal)
-		}
-		ce.tokenizer.Advance()
-
-		// subroutineName
-		name := ce.tokenizer.CurrentToken().Literal
-		if ce.tokenizer.CurrentToken().Type != token.IDENTIFIER {
-			panic("expected identifier but got " + name)
-		}
-		ce.tokenizer.Advance()
-
-		if token.Keyword(methodType) == token.METHOD {
-			ce.subroutineST.Define("this", ce.className, symboltable.ARGUMENT)
-		}
-
-		ce.process("(")
-		ce.compileParameterList()
-		ce.process(")")
-
-		ce.process("{")
-		n := ce.compileVarDec()
-		ce.vmwriter.WriteFunction(ce.className+"."+name, n)
-		if token.Keyword(methodType) == token.CONSTRUCTOR {
-			ce.vmwriter.WritePush(vmwriter.CONSTANT, ce.classST.VarCount(symboltable.FIELD))
-			ce.vmwriter.WriteCall("Memory.alloc", 1)
-			ce.vmwriter.WritePop(vmwriter.POINTER, 0)
-		} else if token.Keyword(methodType) == token.METHOD {
-			ce.vmwriter.WritePush(vmwriter.ARGUMENT, 0)
-			ce.vmwriter.WritePop(vmwriter.POINTER, 0)
-		}
-		ce.compileStatements()
-		ce.process("}")
+func (ce *CompilationEngine) VisitClassVarDec(n *ast.ClassVarDec) {
+	for _, name := range n.Names {
+		ce.classST.Define(name, n.Type, symboltable.KindMap[string(n.Kind)])
 	}
 }
 
-func (ce *CompilationEngine) compileParameterList() {
-	for ce.tokenizer.CurrentToken().Literal != ")" {
-		// type
-		typ := ce.processType()
-
-		// varName
-		name := ce.tokenizer.CurrentToken().Literal
-		if ce.tokenizer.CurrentToken().Type != token.IDENTIFIER {
-			panic("expected identifier but got " + name)
-		}
-		ce.subroutineST.Define(name, typ, symboltable.ARGUMENT)
-		ce.tokenizer.Advance()
+func (ce *CompilationEngine) VisitSubroutineDec(n *ast.SubroutineDec) {
+	ce.subroutineST.Reset()
+	ce.setSource(n.Pos)
 
-		if ce.tokenizer.CurrentToken().Literal == "," {
-			ce.process(",")
-		}
+	if n.Kind == token.METHOD {
+		ce.subroutineST.Define("this", ce.className, symboltable.ARGUMENT)
 	}
-}
-
-func (ce *CompilationEngine) compileVarDec() int {
-	count := 0
-	for ce.tokenizer.CurrentToken().Literal == "var" {
-		ce.process("var")
-		typ := ce.processType()
-
-		// varName
-		for ce.tokenizer.CurrentToken().Literal != ";" {
-			name := ce.tokenizer.CurrentToken().Literal
-			if ce.tokenizer.CurrentToken().Type != token.IDENTIFIER {
-				panic("expected identifier but got " + name)
-			}
-			ce.subroutineST.Define(name, typ, symboltable.VAR_LOCAL)
-			count++
-			ce.tokenizer.Advance()
-
-			if ce.tokenizer.CurrentToken().Literal == "," {
-				ce.process(",")
-			}
+	for _, param := range n.Params {
+		ce.subroutineST.Define(param.Name, param.Type, symboltable.ARGUMENT)
+	}
+	nLocals := 0
+	for _, dec := range n.Body.VarDecs {
+		for _, name := range dec.Names {
+			ce.subroutineST.Define(name, dec.Type, symboltable.VAR_LOCAL)
+			nLocals++
 		}
+	}
 
-		ce.process(";")
+	ce.vmwriter.WriteFunction(ce.className+"."+n.Name, nLocals)
+	if n.Kind == token.CONSTRUCTOR {
+		ce.vmwriter.WritePush(vmwriter.CONSTANT, ce.classST.VarCount(symboltable.FIELD))
+		ce.vmwriter.WriteCall("Memory.alloc", 1)
+		ce.vmwriter.WritePop(vmwriter.POINTER, 0)
+	} else if n.Kind == token.METHOD {
+		ce.vmwriter.WritePush(vmwriter.ARGUMENT, 0)
+		ce.vmwriter.WritePop(vmwriter.POINTER, 0)
 	}
-	return count
+	ce.compileStatements(n.Body.Statements)
 }
 
-func (ce *CompilationEngine) compileStatements() {
-	statementPrefix := []token.Keyword{token.LET, token.IF, token.WHILE, token.DO, token.RETURN}
-	for slices.Contains(statementPrefix, token.Keyword(ce.tokenizer.CurrentToken().Literal)) {
-		switch token.Keyword(ce.tokenizer.CurrentToken().Literal) {
-		case token.LET:
-			ce.compileLet()
-		case token.IF:
-			ce.compileIf()
-		case token.WHILE:
-			ce.compileWhile()
-		case token.DO:
-			ce.compileDo()
-		case token.RETURN:
-			ce.compileReturn()
+func (ce *CompilationEngine) compileStatements(statements []ast.Statement) {
+	// The code that follows nested statements belongs to the enclosing
+	// statement again.
+	outer := ce.source
+	defer ce.setSource(outer)
+	for _, statement := range statements {
+		pos := statement.Position()
+		ce.setSource(pos)
+		if ce.emitComments {
+			ce.vmwriter.WriteComment(pos.File + ":" + strconv.Itoa(pos.Line) + ": " + strings.TrimSpace(ce.tokenizer.SourceLine(pos.Line)))
 		}
+		statement.Accept(ce)
 	}
 }
 
-func (ce *CompilationEngine) compileLet() {
-	ce.process("let")
-
-	// varName
-	name := ce.tokenizer.CurrentToken().Literal
-	if ce.tokenizer.CurrentToken().Type != token.IDENTIFIER {
-		panic("expected identifier but got " + name)
-	}
-	ce.tokenizer.Advance()
-
-	if ce.tokenizer.CurrentToken().Literal == "[" {
-		ce.process("[")
-		ce.compileExpression()
-		ce.process("]")
-		ce.writePushVariable(name)
+func (ce *CompilationEngine) VisitLetStatement(n *ast.LetStatement) {
+	if n.Index != nil {
+		n.Index.Accept(ce)
+		ce.writePushVariable(n.Name, n.NamePos)
 		ce.vmwriter.WriteArithmetic(vmwriter.ADD)
-		ce.process("=")
-		ce.compileExpression()
-		ce.process(";")
+		n.Value.Accept(ce)
 		ce.vmwriter.WritePop(vmwriter.TEMP, 0)
 		ce.vmwriter.WritePop(vmwriter.POINTER, 1)
 		ce.vmwriter.WritePush(vmwriter.TEMP, 0)
 		ce.vmwriter.WritePop(vmwriter.THAT, 0)
 	} else {
-		ce.process("=")
-		ce.compileExpression()
-		ce.process(";")
-		ce.writePopVariable(name)
+		n.Value.Accept(ce)
+		ce.writePopVariable(n.Name, n.NamePos)
 	}
 }
 
-func (ce *CompilationEngine) compileIf() {
+func (ce *CompilationEngine) VisitIfStatement(n *ast.IfStatement) {
 	firstLabelName := ce.className + "_" + strconv.Itoa(ce.labelCount)
 	secondLabelName := ce.className + "_" + strconv.Itoa(ce.labelCount+1)
 	ce.labelCount += 2
 
-	ce.process("if")
-	ce.process("(")
-	ce.compileExpression()
-	ce.process(")")
+	n.Condition.Accept(ce)
 	ce.vmwriter.WriteArithmetic(vmwriter.NOT)
 	ce.vmwriter.WriteIf(secondLabelName)
-	ce.process("{")
-	ce.compileStatements()
-	ce.process("}")
+	ce.compileStatements(n.Then.Statements)
 	ce.vmwriter.WriteGoto(firstLabelName)
 	ce.vmwriter.WriteLabel(secondLabelName)
-	if ce.tokenizer.CurrentToken().Literal == "else" {
-		ce.process("else")
-		ce.process("{")
-		ce.compileStatements()
-		ce.process("}")
+	if n.Else != nil {
+		ce.compileStatements(n.Else.Statements)
 	}
 	ce.vmwriter.WriteLabel(firstLabelName)
 }
 
-func (ce *CompilationEngine) compileWhile() {
+func (ce *CompilationEngine) VisitWhileStatement(n *ast.WhileStatement) {
 	firstLabelName := ce.className + "_" + strconv.Itoa(ce.labelCount)
 	secondLabelName := ce.className + "_" + strconv.Itoa(ce.labelCount+1)
 	ce.labelCount += 2
 
-	ce.process("while")
-	ce.process("(")
 	ce.vmwriter.WriteLabel(firstLabelName)
-	ce.compileExpression()
+	n.Condition.Accept(ce)
 	ce.vmwriter.WriteArithmetic(vmwriter.NOT)
 	ce.vmwriter.WriteIf(secondLabelName)
-	ce.process(")")
-	ce.process("{")
-	ce.compileStatements()
+	ce.compileStatements(n.Body.Statements)
 	ce.vmwriter.WriteGoto(firstLabelName)
 	ce.vmwriter.WriteLabel(secondLabelName)
-	ce.process("}")
 }
 
-func (ce *CompilationEngine) compileDo() {
-	args := 0
-	ce.process("do")
-
-	// subroutineCall
-	name := ce.tokenizer.CurrentToken().Literal
-	if ce.tokenizer.CurrentToken().Type != token.IDENTIFIER {
-		panic("expected identifier but got " + name)
-	}
-	if ce.subroutineST.IndexOf(name) != -1 {
-		ce.vmwriter.WritePush(kindSegmentMap[ce.subroutineST.KindOf(name)], ce.subroutineST.IndexOf(name))
-		name = ce.subroutineST.TypeOf(name)
-		args++
-	} else if ce.classST.IndexOf(name) != -1 {
-		ce.vmwriter.WritePush(kindSegmentMap[ce.classST.KindOf(name)], ce.classST.IndexOf(name))
-		name = ce.classST.TypeOf(name)
-		args++
-	}
-	ce.tokenizer.Advance()
-	if ce.tokenizer.CurrentToken().Literal == "." {
-		ce.process(".")
-		n := ce.tokenizer.CurrentToken().Literal
-		if ce.tokenizer.CurrentToken().Type != token.IDENTIFIER {
-			panic("expected identifier but got " + n)
-		}
-		name += "." + n
-		ce.tokenizer.Advance()
-	} else {
-		name = ce.className + "." + name
-		ce.vmwriter.WritePush(vmwriter.POINTER, 0)
-		args++
-	}
-
-	ce.process("(")
-	args += ce.compileExpressionList()
-	ce.process(")")
-	ce.process(";")
-
-	ce.vmwriter.WriteCall(name, args)
+func (ce *CompilationEngine) VisitDoStatement(n *ast.DoStatement) {
+	n.Call.Accept(ce)
 	ce.vmwriter.WritePop(vmwriter.TEMP, 0)
 }
 
-func (ce *CompilationEngine) compileReturn() {
-	ce.process("return")
-	if ce.tokenizer.CurrentToken().Literal == ";" {
+func (ce *CompilationEngine) VisitReturnStatement(n *ast.ReturnStatement) {
+	if n.Value == nil {
 		ce.vmwriter.WritePush(vmwriter.CONSTANT, 0)
 	} else {
-		ce.compileExpression()
+		n.Value.Accept(ce)
 	}
 	ce.vmwriter.WriteReturn()
-	ce.process(";")
 }
 
-func (ce *CompilationEngine) compileExpression() {
-	ce.compileTerm()
-
-	operand := []token.Symbol{token.PLUS, token.MINUS, token.ASTERISK, token.SLASH, token.AND, token.PIPE, token.LESS_THAN, token.GREATER_THAN, token.EQUAL}
-	for slices.Contains(operand, token.Symbol(ce.tokenizer.CurrentToken().Literal)) {
-		op := ce.tokenizer.CurrentToken().Literal
-		ce.process(op)
-		ce.compileTerm()
-		switch token.Symbol(op) {
-		case token.PLUS:
-			ce.vmwriter.WriteArithmetic(vmwriter.ADD)
-		case token.MINUS:
-			ce.vmwriter.WriteArithmetic(vmwriter.SUB)
-		case token.ASTERISK:
-			ce.vmwriter.WriteCall("Math.multiply", 2)
-		case token.SLASH:
-			ce.vmwriter.WriteCall("Math.divide", 2)
-		case token.AND:
-			ce.vmwriter.WriteArithmetic(vmwriter.AND)
-		case token.PIPE:
-			ce.vmwriter.WriteArithmetic(vmwriter.OR)
-		case token.LESS_THAN:
-			ce.vmwriter.WriteArithmetic(vmwriter.LT)
-		case token.GREATER_THAN:
-			ce.vmwriter.WriteArithmetic(vmwriter.GT)
-		case token.EQUAL:
-			ce.vmwriter.WriteArithmetic(vmwriter.EQ)
-		}
-	}
+func (ce *CompilationEngine) VisitIntegerConstant(n *ast.IntegerConstant) {
+	ce.vmwriter.WritePush(vmwriter.CONSTANT, n.Value)
 }
 
-func (ce *CompilationEngine) compileTerm() {
-	switch ce.tokenizer.CurrentToken().Type {
-	case token.INT_CONST:
-		value, err := strconv.Atoi(ce.tokenizer.CurrentToken().Literal)
-		if err != nil {
-			panic("expected integer constant but got " + ce.tokenizer.CurrentToken().Literal)
-		}
-		ce.vmwriter.WritePush(vmwriter.CONSTANT, value)
-		ce.tokenizer.Advance()
-		return
-	case token.STRING_CONST:
-		ce.vmwriter.WritePush(vmwriter.CONSTANT, len(ce.tokenizer.CurrentToken().Literal))
-		ce.vmwriter.WriteCall("String.new", 1)
-		for _, c := range ce.tokenizer.CurrentToken().Literal {
-			ce.vmwriter.WritePush(vmwriter.CONSTANT, int(c))
-			ce.vmwriter.WriteCall("String.appendChar", 2)
-		}
-		ce.tokenizer.Advance()
-		return
+func (ce *CompilationEngine) VisitStringConstant(n *ast.StringConstant) {
+	ce.vmwriter.WritePush(vmwriter.CONSTANT, len(n.Value))
+	ce.vmwriter.WriteCall("String.new", 1)
+	for _, c := range n.Value {
+		ce.vmwriter.WritePush(vmwriter.CONSTANT, int(c))
+		ce.vmwriter.WriteCall("String.appendChar", 2)
 	}
+}
 
-	switch ce.tokenizer.CurrentToken().Literal {
-	case string(token.TRUE):
+func (ce *CompilationEngine) VisitKeywordConstant(n *ast.KeywordConstant) {
+	switch n.Keyword {
+	case token.TRUE:
 		ce.vmwriter.WritePush(vmwriter.CONSTANT, 1)
 		ce.vmwriter.WriteArithmetic(vmwriter.NEG)
-		ce.tokenizer.Advance()
-		return
-	case string(token.FALSE), string(token.NULL):
+	case token.FALSE, token.NULL:
 		ce.vmwriter.WritePush(vmwriter.CONSTANT, 0)
-		ce.tokenizer.Advance()
-		return
-	case string(token.THIS):
+	case token.THIS:
 		ce.vmwriter.WritePush(vmwriter.POINTER, 0)
-		ce.tokenizer.Advance()
-		return
-	case "(":
-		ce.process("(")
-		ce.compileExpression()
-		ce.process(")")
-		return
-	case "-":
-		ce.process("-")
-		ce.compileTerm()
-		ce.vmwriter.WriteArithmetic(vmwriter.NEG)
-		return
-	case "~":
-		ce.process("~")
-		ce.compileTerm()
-		ce.vmwriter.WriteArithmetic(vmwriter.NOT)
-		return
 	}
+}
+
+func (ce *CompilationEngine) VisitVarName(n *ast.VarName) {
+	ce.writePushVariable(n.Name, n.Pos)
+}
+
+func (ce *CompilationEngine) VisitArrayElement(n *ast.ArrayElement) {
+	n.Index.Accept(ce)
+	ce.writePushVariable(n.Name, n.Pos)
+	ce.vmwriter.WriteArithmetic(vmwriter.ADD)
+	ce.vmwriter.WritePop(vmwriter.POINTER, 1)
+	ce.vmwriter.WritePush(vmwriter.THAT, 0)
+}
 
-	name := ce.tokenizer.CurrentToken().Literal
-	if ce.tokenizer.CurrentToken().Type != token.IDENTIFIER {
-		panic("expected identifier but got " + name)
+// VisitCallExpression compiles name(...), a method call on this object, and
+// receiver.name(...), a method call on the variable receiver or a call of a
+// function or constructor of the class receiver.
+func (ce *CompilationEngine) VisitCallExpression(n *ast.CallExpression) {
+	args := 0
+	name := n.Receiver
+	if n.Receiver == "" {
+		name = ce.className
+		ce.vmwriter.WritePush(vmwriter.POINTER, 0)
+		args++
+	} else if ce.subroutineST.IndexOf(n.Receiver) != -1 || ce.classST.IndexOf(n.Receiver) != -1 {
+		// the object is passed as argument 0
+		ce.writePushVariable(n.Receiver, n.Pos)
+		name = ce.typeOf(n.Receiver)
+		args++
 	}
-	ce.tokenizer.Advance()
-
-	switch ce.tokenizer.CurrentToken().Literal {
-	case "[":
-		ce.process("[")
-		ce.compileExpression()
-		ce.process("]")
-		ce.writePushVariable(name)
-		ce.vmwriter.WriteArithmetic(vmwriter.ADD)
-		ce.vmwriter.WritePop(vmwriter.POINTER, 1)
-		ce.vmwriter.WritePush(vmwriter.THAT, 0)
-	case "(":
-		ce.process("(")
-		ce.compileExpressionList()
-		ce.process(")")
-	case ".":
-		args := 0
-		if ce.subroutineST.IndexOf(name) != -1 {
-			ce.vmwriter.WritePush(kindSegmentMap[ce.subroutineST.KindOf(name)], ce.subroutineST.IndexOf(name))
-			name = ce.subroutineST.TypeOf(name)
-			args++
-		} else if ce.classST.IndexOf(name) != -1 {
-			ce.vmwriter.WritePush(kindSegmentMap[ce.classST.KindOf(name)], ce.classST.IndexOf(name))
-			name = ce.classST.TypeOf(name)
-			args++
-		}
-		ce.process(".")
-		subroutineName := ce.tokenizer.CurrentToken().Literal
-		if ce.tokenizer.CurrentToken().Type != token.IDENTIFIER {
-			panic("expected identifier but got " + subroutineName)
-		}
-		ce.tokenizer.Advance()
-		ce.process("(")
-		args += ce.compileExpressionList()
-		ce.process(")")
-		ce.vmwriter.WriteCall(name+"."+subroutineName, args)
-	default:
-		ce.writePushVariable(name)
+	for _, arg := range n.Args {
+		arg.Accept(ce)
 	}
+	ce.vmwriter.WriteCall(name+"."+n.Name, args+len(n.Args))
 }
 
-func (ce *CompilationEngine) compileExpressionList() int {
-	count := 0
-
-	for ce.tokenizer.CurrentToken().Literal != ")" {
-		ce.compileExpression()
-		count++
-		if ce.tokenizer.CurrentToken().Literal == "," {
-			ce.process(",")
-		}
+func (ce *CompilationEngine) VisitUnaryExpression(n *ast.UnaryExpression) {
+	n.Operand.Accept(ce)
+	switch n.Op {
+	case token.MINUS:
+		ce.vmwriter.WriteArithmetic(vmwriter.NEG)
+	case token.TILDE:
+		ce.vmwriter.WriteArithmetic(vmwriter.NOT)
 	}
-	return count
 }
 
-func (ce *CompilationEngine) process(str string) string {
-	if ce.tokenizer.CurrentToken().Literal != str {
-		panic("expected " + str + " but got " + ce.tokenizer.CurrentToken().Literal)
+func (ce *CompilationEngine) VisitBinaryExpression(n *ast.BinaryExpression) {
+	n.Left.Accept(ce)
+	n.Right.Accept(ce)
+	switch n.Op {
+	case token.PLUS:
+		ce.vmwriter.WriteArithmetic(vmwriter.ADD)
+	case token.MINUS:
+		ce.vmwriter.WriteArithmetic(vmwriter.SUB)
+	case token.ASTERISK:
+		ce.vmwriter.WriteCall("Math.multiply", 2)
+	case token.SLASH:
+		ce.vmwriter.WriteCall("Math.divide", 2)
+	case token.AND:
+		ce.vmwriter.WriteArithmetic(vmwriter.AND)
+	case token.PIPE:
+		ce.vmwriter.WriteArithmetic(vmwriter.OR)
+	case token.LESS_THAN:
+		ce.vmwriter.WriteArithmetic(vmwriter.LT)
+	case token.GREATER_THAN:
+		ce.vmwriter.WriteArithmetic(vmwriter.GT)
+	case token.EQUAL:
+		ce.vmwriter.WriteArithmetic(vmwriter.EQ)
 	}
-	ce.tokenizer.Advance()
-	return str
 }
 
-func (ce *CompilationEngine) processType() string {
-	types := []token.Keyword{token.INT, token.CHAR, token.BOOLEAN}
-	t := ce.tokenizer.CurrentToken().Literal
-	if ce.tokenizer.CurrentToken().Type != token.IDENTIFIER && !slices.Contains(types, token.Keyword(t)) {
-		panic("expected type but got " + ce.tokenizer.CurrentToken().Literal)
+func (ce *CompilationEngine) VisitParenExpression(n *ast.ParenExpression) {
+	n.Expression.Accept(ce)
+}
+
+// setSource records pos as the Jack source of the VM commands written next.
+func (ce *CompilationEngine) setSource(pos token.Position) {
+	ce.source = pos
+	ce.vmwriter.SetSource(pos.File, pos.Line, pos.Column)
+}
+
+// typeOf returns the type of the variable name, looking in the subroutine
+// scope first.
+func (ce *CompilationEngine) typeOf(name string) string {
+	if ce.subroutineST.IndexOf(name) != -1 {
+		return ce.subroutineST.TypeOf(name)
 	}
-	ce.tokenizer.Advance()
-	return t
+	return ce.classST.TypeOf(name)
 }
 
-func (ce *CompilationEngine) writePushVariable(name string) {
+func (ce *CompilationEngine) writePushVariable(name string, pos token.Position) {
 	if ce.subroutineST.IndexOf(name) != -1 {
 		ce.vmwriter.WritePush(kindSegmentMap[ce.subroutineST.KindOf(name)], ce.subroutineST.IndexOf(name))
 	} else if ce.classST.IndexOf(name) != -1 {
 		ce.vmwriter.WritePush(kindSegmentMap[ce.classST.KindOf(name)], ce.classST.IndexOf(name))
 	} else {
-		panic("undefined variable " + name)
+		ce.errors.Add(pos, "undefined variable "+name)
 	}
 }
 
-func (ce *CompilationEngine) writePopVariable(name string) {
+func (ce *CompilationEngine) writePopVariable(name string, pos token.Position) {
 	if ce.subroutineST.IndexOf(name) != -1 {
 		ce.vmwriter.WritePop(kindSegmentMap[ce.subroutineST.KindOf(name)], ce.subroutineST.IndexOf(name))
 	} else if ce.classST.IndexOf(name) != -1 {
 		ce.vmwriter.WritePop(kindSegmentMap[ce.classST.KindOf(name)], ce.classST.IndexOf(name))
 	} else {
-		panic("undefined variable " + name)
+		ce.errors.Add(pos, "undefined variable "+name)
 	}
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -24,12 +26,16 @@ func getClassName(jackFilePath string) string {
 }
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: go run main.go [filename.jack or directory]")
+	emitComments := flag.Bool("emit-comments", false, "write each statement's Jack source line as a comment before its VM code")
+	sourceMap := flag.Bool("source-map", false, "write a <name>.map.json source map from .vm lines to Jack positions next to each .vm file")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Println("Usage: go run main.go [flags] [filename.jack or directory]")
+		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
-	path := os.Args[1]
+	path := flag.Arg(0)
 	var jackFiles []string
 
 	fileInfo, err := os.Stat(path)
@@ -61,6 +67,9 @@ func main() {
 		jackFiles = append(jackFiles, path)
 	}
 
+	// report the errors of every file and write the .vm files of the classes
+	// that compile
+	failed := false
 	for _, jackFile := range jackFiles {
 		content, err := os.ReadFile(jackFile)
 		if err != nil {
@@ -68,6 +77,17 @@ func main() {
 			os.Exit(1)
 		}
 
+		n := getClassName(jackFile)
+		t := tokenizer.New(filepath.Base(jackFile), string(content))
+		w := vmwriter.New()
+		ce := compilationengine.New(n, t, w)
+		ce.SetEmitComments(*emitComments)
+		if err := ce.CompileClass(); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			failed = true
+			continue
+		}
+
 		vmPath := getVMPath(jackFile)
 		vmFile, err := os.Create(vmPath)
 		if err != nil {
@@ -75,12 +95,25 @@ func main() {
 			os.Exit(1)
 		}
 		defer vmFile.Close()
-
-		n := getClassName(jackFile)
-		t := tokenizer.New(string(content))
-		w := vmwriter.New()
-		ce := compilationengine.New(n, t, w)
-		ce.CompileClass()
 		vmFile.WriteString(w.Code)
+
+		if *sourceMap {
+			mapPath := strings.TrimSuffix(vmPath, ".vm") + ".map.json"
+			if err := writeSourceMap(mapPath, w.SourceMap); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing source map %s: %v\n", mapPath, err)
+				os.Exit(1)
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func writeSourceMap(path string, entries []vmwriter.SourceMapEntry) error {
+	content, err := json.Marshal(entries)
+	if err != nil {
+		return err
 	}
+	return os.WriteFile(path, content, 0644)
 }
@@ -0,0 +1,476 @@
+package parser
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/youchann/nand2tetris/11-2_vmwriter/ast"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/token"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/tokenizer"
+)
+
+var operators = []token.Symbol{token.PLUS, token.MINUS, token.ASTERISK, token.SLASH, token.AND, token.PIPE, token.LESS_THAN, token.GREATER_THAN, token.EQUAL}
+
+// Keywords that start a statement or a declaration, where parsing resumes
+// after a syntax error.
+var (
+	statementKeywords = []token.Keyword{token.LET, token.IF, token.WHILE, token.DO, token.RETURN}
+	memberKeywords    = []token.Keyword{token.STATIC, token.FIELD, token.CONSTRUCTOR, token.FUNCTION, token.METHOD}
+)
+
+// Error is an error at a position in a Jack file.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+// ErrorList is a list of errors in source order. Its Error method returns
+// one error per line.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	var result []string
+	for _, e := range l {
+		result = append(result, e.Error())
+	}
+	return strings.Join(result, "\n")
+}
+
+// Add appends an error unless the last one is at the same position.
+func (l *ErrorList) Add(pos token.Position, msg string) {
+	if n := len(*l); n > 0 && (*l)[n-1].Pos == pos {
+		return
+	}
+	*l = append(*l, &Error{Pos: pos, Msg: msg})
+}
+
+// bailout is the panic of fail. It unwinds the parser to the enclosing
+// statement or declaration, which resynchronizes.
+type bailout struct{}
+
+type Parser struct {
+	tokenizer *tokenizer.JackTokenizer
+	errors    ErrorList
+}
+
+func New(t *tokenizer.JackTokenizer) *Parser {
+	return &Parser{
+		tokenizer: t,
+		errors:    nil,
+	}
+}
+
+// ParseClass parses the class the tokenizer reads. After a syntax error it
+// skips to the next statement or declaration and goes on, so that the
+// returned ErrorList holds every syntax error of the file, together with
+// the lexical errors of the tokenizer. The class is incomplete if there are
+// errors.
+func (p *Parser) ParseClass() (class *ast.Class, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+		}
+		p.addDiagnostics()
+		if len(p.errors) > 0 {
+			err = p.errors
+		}
+	}()
+	class = &ast.Class{Pos: p.tokenizer.CurrentToken().Pos}
+	p.process("class")
+	class.NamePos = p.tokenizer.CurrentToken().Pos
+	class.Name = p.processIdentifier()
+	p.process("{")
+	for {
+		current := p.tokenizer.CurrentToken()
+		switch token.Keyword(current.Literal) {
+		case token.STATIC, token.FIELD:
+			p.try(func() { class.VarDecs = append(class.VarDecs, p.parseClassVarDec()) }, memberKeywords)
+			continue
+		case token.CONSTRUCTOR, token.FUNCTION, token.METHOD:
+			p.try(func() { class.Subroutines = append(class.Subroutines, p.parseSubroutine()) }, memberKeywords)
+			continue
+		}
+		if current.Literal == "}" || current.Type == token.EOF {
+			break
+		}
+		p.try(func() { p.fail("expected declaration but got " + current.Literal) }, memberKeywords)
+	}
+	class.Rbrace = p.tokenizer.CurrentToken().Pos
+	p.process("}")
+	if p.tokenizer.CurrentToken().Type != token.EOF {
+		p.fail("expected end of file but got " + p.tokenizer.CurrentToken().Literal)
+	}
+	return class, nil
+}
+
+func (p *Parser) parseClassVarDec() *ast.ClassVarDec {
+	dec := &ast.ClassVarDec{Pos: p.tokenizer.CurrentToken().Pos}
+	// static or field
+	dec.Kind = token.Keyword(p.process(p.tokenizer.CurrentToken().Literal))
+	dec.Type = p.processType()
+	dec.Names = p.parseNames()
+	return dec
+}
+
+func (p *Parser) parseSubroutine() *ast.SubroutineDec {
+	dec := &ast.SubroutineDec{Pos: p.tokenizer.CurrentToken().Pos}
+	// constructor, function, or method
+	dec.Kind = token.Keyword(p.process(p.tokenizer.CurrentToken().Literal))
+
+	// void or type
+	if p.tokenizer.CurrentToken().Literal == string(token.VOID) {
+		dec.ReturnType = p.process(string(token.VOID))
+	} else {
+		if !p.isType() {
+			p.fail("expected type or void but got " + p.tokenizer.CurrentToken().Literal)
+		}
+		dec.ReturnType = p.processType()
+	}
+	dec.Name = p.processIdentifier()
+
+	p.process("(")
+	dec.Params = p.parseParameterList()
+	p.process(")")
+
+	body := &ast.SubroutineBody{Lbrace: p.tokenizer.CurrentToken().Pos}
+	p.process("{")
+	for p.tokenizer.CurrentToken().Literal == "var" {
+		p.try(func() { body.VarDecs = append(body.VarDecs, p.parseVarDec()) }, slices.Concat([]token.Keyword{token.VAR}, statementKeywords, memberKeywords))
+	}
+	body.Statements = p.parseStatements()
+	body.Rbrace = p.tokenizer.CurrentToken().Pos
+	p.process("}")
+	dec.Body = body
+	return dec
+}
+
+func (p *Parser) parseParameterList() []*ast.Parameter {
+	var params []*ast.Parameter
+	for p.tokenizer.CurrentToken().Literal != ")" {
+		if len(params) > 0 {
+			p.process(",")
+		}
+		param := &ast.Parameter{Pos: p.tokenizer.CurrentToken().Pos}
+		param.Type = p.processType()
+		param.Name = p.processIdentifier()
+		params = append(params, param)
+	}
+	return params
+}
+
+func (p *Parser) parseVarDec() *ast.VarDec {
+	dec := &ast.VarDec{Pos: p.tokenizer.CurrentToken().Pos}
+	p.process("var")
+	dec.Type = p.processType()
+	dec.Names = p.parseNames()
+	return dec
+}
+
+// parseNames parses the variable names of a declaration up to its ;.
+func (p *Parser) parseNames() []string {
+	names := []string{p.processIdentifier()}
+	for p.tokenizer.CurrentToken().Literal == "," {
+		p.process(",")
+		names = append(names, p.processIdentifier())
+	}
+	p.process(";")
+	return names
+}
+
+func (p *Parser) parseBlock() *ast.Block {
+	block := &ast.Block{Lbrace: p.tokenizer.CurrentToken().Pos}
+	p.process("{")
+	block.Statements = p.parseStatements()
+	block.Rbrace = p.tokenizer.CurrentToken().Pos
+	p.process("}")
+	return block
+}
+
+// parseStatements parses statements up to the } that closes them. It also
+// stops at a declaration, which means that the } is missing.
+func (p *Parser) parseStatements() []ast.Statement {
+	var statements []ast.Statement
+	for {
+		current := p.tokenizer.CurrentToken()
+		if current.Literal == "}" || current.Type == token.EOF || p.isMemberKeyword() {
+			return statements
+		}
+		p.try(func() {
+			switch token.Keyword(current.Literal) {
+			case token.LET:
+				statements = append(statements, p.parseLet())
+			case token.IF:
+				statements = append(statements, p.parseIf())
+			case token.WHILE:
+				statements = append(statements, p.parseWhile())
+			case token.DO:
+				statements = append(statements, p.parseDo())
+			case token.RETURN:
+				statements = append(statements, p.parseReturn())
+			default:
+				p.fail("expected statement but got " + current.Literal)
+			}
+		}, slices.Concat(statementKeywords, memberKeywords))
+	}
+}
+
+func (p *Parser) parseLet() *ast.LetStatement {
+	statement := &ast.LetStatement{Pos: p.tokenizer.CurrentToken().Pos}
+	p.process("let")
+	statement.NamePos = p.tokenizer.CurrentToken().Pos
+	statement.Name = p.processIdentifier()
+	if p.tokenizer.CurrentToken().Literal == "[" {
+		p.process("[")
+		statement.Index = p.parseExpression()
+		p.process("]")
+	}
+	p.process("=")
+	statement.Value = p.parseExpression()
+	p.process(";")
+	return statement
+}
+
+func (p *Parser) parseIf() *ast.IfStatement {
+	statement := &ast.IfStatement{Pos: p.tokenizer.CurrentToken().Pos}
+	p.process("if")
+	p.process("(")
+	statement.Condition = p.parseExpression()
+	p.process(")")
+	statement.Then = p.parseBlock()
+	if p.tokenizer.CurrentToken().Literal == "else" {
+		p.process("else")
+		statement.Else = p.parseBlock()
+	}
+	return statement
+}
+
+func (p *Parser) parseWhile() *ast.WhileStatement {
+	statement := &ast.WhileStatement{Pos: p.tokenizer.CurrentToken().Pos}
+	p.process("while")
+	p.process("(")
+	statement.Condition = p.parseExpression()
+	p.process(")")
+	statement.Body = p.parseBlock()
+	return statement
+}
+
+func (p *Parser) parseDo() *ast.DoStatement {
+	statement := &ast.DoStatement{Pos: p.tokenizer.CurrentToken().Pos}
+	p.process("do")
+	statement.Call = p.parseSubroutineCall()
+	p.process(";")
+	return statement
+}
+
+func (p *Parser) parseReturn() *ast.ReturnStatement {
+	statement := &ast.ReturnStatement{Pos: p.tokenizer.CurrentToken().Pos}
+	p.process("return")
+	if p.tokenizer.CurrentToken().Literal != ";" {
+		statement.Value = p.parseExpression()
+	}
+	p.process(";")
+	return statement
+}
+
+func (p *Parser) parseExpression() ast.Expression {
+	expression := p.parseTerm()
+	for slices.Contains(operators, token.Symbol(p.tokenizer.CurrentToken().Literal)) {
+		binary := &ast.BinaryExpression{Left: expression, OpPos: p.tokenizer.CurrentToken().Pos}
+		binary.Op = token.Symbol(p.process(p.tokenizer.CurrentToken().Literal))
+		binary.Right = p.parseTerm()
+		expression = binary
+	}
+	return expression
+}
+
+func (p *Parser) parseTerm() ast.Expression {
+	current := p.tokenizer.CurrentToken()
+	switch current.Type {
+	case token.INT_CONST:
+		value, err := p.tokenizer.IntVal()
+		if err != nil {
+			p.fail(err.Error())
+		}
+		p.tokenizer.Advance()
+		return &ast.IntegerConstant{Pos: current.Pos, Value: value}
+	case token.STRING_CONST:
+		p.tokenizer.Advance()
+		return &ast.StringConstant{Pos: current.Pos, Value: current.Literal}
+	}
+
+	switch current.Literal {
+	case string(token.TRUE), string(token.FALSE), string(token.NULL), string(token.THIS):
+		p.tokenizer.Advance()
+		return &ast.KeywordConstant{Pos: current.Pos, Keyword: token.Keyword(current.Literal)}
+	case "(":
+		p.process("(")
+		expression := p.parseExpression()
+		p.process(")")
+		return &ast.ParenExpression{Pos: current.Pos, Expression: expression}
+	case "-", "~":
+		p.process(current.Literal)
+		return &ast.UnaryExpression{Pos: current.Pos, Op: token.Symbol(current.Literal), Operand: p.parseTerm()}
+	}
+
+	if current.Type != token.IDENTIFIER {
+		p.fail("expected identifier but got " + current.Literal)
+	}
+	// varName, varName[expression] or subroutineCall
+	switch p.tokenizer.Peek(1).Literal {
+	case "[":
+		p.tokenizer.Advance()
+		p.process("[")
+		index := p.parseExpression()
+		p.process("]")
+		return &ast.ArrayElement{Pos: current.Pos, Name: current.Literal, Index: index}
+	case "(", ".":
+		return p.parseSubroutineCall()
+	default:
+		p.tokenizer.Advance()
+		return &ast.VarName{Pos: current.Pos, Name: current.Literal}
+	}
+}
+
+// parseSubroutineCall parses name(...) and receiver.name(...).
+func (p *Parser) parseSubroutineCall() *ast.CallExpression {
+	call := &ast.CallExpression{Pos: p.tokenizer.CurrentToken().Pos}
+	if p.tokenizer.Peek(1).Literal == "." {
+		call.Receiver = p.processIdentifier()
+		p.process(".")
+	}
+	call.NamePos = p.tokenizer.CurrentToken().Pos
+	call.Name = p.processIdentifier()
+	p.process("(")
+	call.Args = p.parseExpressionList()
+	p.process(")")
+	return call
+}
+
+func (p *Parser) parseExpressionList() []ast.Expression {
+	var expressions []ast.Expression
+	for p.tokenizer.CurrentToken().Literal != ")" {
+		if len(expressions) > 0 {
+			p.process(",")
+		}
+		expressions = append(expressions, p.parseExpression())
+	}
+	return expressions
+}
+
+// try runs parse and, if it fails, skips to where parsing can resume: past
+// a ;, before a } that closes the enclosing block, or before one of
+// keywords. A block opened on the way is skipped whole and ends the failed
+// statement or declaration unless an else follows.
+func (p *Parser) try(parse func(), keywords []token.Keyword) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if _, ok := r.(bailout); !ok {
+			panic(r)
+		}
+		depth := 0
+		for {
+			current := p.tokenizer.CurrentToken()
+			switch {
+			case current.Type == token.EOF:
+				return
+			case current.Literal == "{":
+				depth++
+			case current.Literal == "}":
+				if depth == 0 {
+					return
+				}
+				depth--
+				if depth == 0 && p.tokenizer.Peek(1).Literal != string(token.ELSE) {
+					p.tokenizer.Advance()
+					return
+				}
+			case depth > 0:
+			case current.Literal == ";":
+				p.tokenizer.Advance()
+				return
+			case current.Type == token.KEYWORD && slices.Contains(keywords, token.Keyword(current.Literal)):
+				return
+			}
+			p.tokenizer.Advance()
+		}
+	}()
+	parse()
+}
+
+// fail records msg at the position of the current token and unwinds to the
+// enclosing try.
+func (p *Parser) fail(msg string) {
+	current := p.tokenizer.CurrentToken()
+	if current.Type == token.EOF {
+		msg = "unexpected end of file"
+	}
+	p.errors.Add(current.Pos, msg)
+	panic(bailout{})
+}
+
+// addDiagnostics scans the rest of the file and merges the lexical errors
+// of the tokenizer into the errors in source order. A lexical error
+// replaces the syntax error at the same position, which only says that its
+// token was unexpected.
+func (p *Parser) addDiagnostics() {
+	mark := p.tokenizer.Mark()
+	for p.tokenizer.CurrentToken().Type != token.EOF {
+		p.tokenizer.Advance()
+	}
+	p.tokenizer.Reset(mark)
+
+	for _, d := range p.tokenizer.Diagnostics() {
+		i := slices.IndexFunc(p.errors, func(e *Error) bool { return e.Pos.Offset == d.Pos.Offset })
+		if i < 0 {
+			p.errors = append(p.errors, &Error{Pos: d.Pos, Msg: d.Message})
+		} else {
+			p.errors[i].Msg = d.Message
+		}
+	}
+	slices.SortStableFunc(p.errors, func(a, b *Error) int { return a.Pos.Offset - b.Pos.Offset })
+}
+
+func (p *Parser) process(str string) string {
+	if p.tokenizer.CurrentToken().Literal != str {
+		p.fail("expected " + str + " but got " + p.tokenizer.CurrentToken().Literal)
+	}
+	p.tokenizer.Advance()
+	return str
+}
+
+func (p *Parser) processIdentifier() string {
+	name := p.tokenizer.CurrentToken().Literal
+	if p.tokenizer.CurrentToken().Type != token.IDENTIFIER {
+		p.fail("expected identifier but got " + name)
+	}
+	p.tokenizer.Advance()
+	return name
+}
+
+func (p *Parser) isMemberKeyword() bool {
+	current := p.tokenizer.CurrentToken()
+	return current.Type == token.KEYWORD && slices.Contains(memberKeywords, token.Keyword(current.Literal))
+}
+
+func (p *Parser) isType() bool {
+	types := []token.Keyword{token.INT, token.CHAR, token.BOOLEAN}
+	return p.tokenizer.CurrentToken().Type == token.IDENTIFIER || slices.Contains(types, token.Keyword(p.tokenizer.CurrentToken().Literal))
+}
+
+func (p *Parser) processType() string {
+	t := p.tokenizer.CurrentToken().Literal
+	if !p.isType() {
+		p.fail("expected type but got " + t)
+	}
+	p.tokenizer.Advance()
+	return t
+}
@@ -0,0 +1,152 @@
+package parser_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/youchann/nand2tetris/11-2_vmwriter/ast"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/parser"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/token"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/tokenizer"
+)
+
+func parse(t *testing.T, src string) (*ast.Class, error) {
+	t.Helper()
+	return parser.New(tokenizer.New("Main.jack", src)).ParseClass()
+}
+
+func TestParseClass(t *testing.T) {
+	src := `class Main {
+  field int x, y;
+  method int f(int a, Array b) {
+    var int i;
+    let b[i] = a + 1 * 2;
+    if (~(i = 0)) { do Output.printInt(-i); } else { do g(); }
+    return this;
+  }
+}
+`
+	class, err := parse(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if class.Name != "Main" || class.NamePos.Line != 1 || class.NamePos.Column != 7 || class.Rbrace.Line != 9 {
+		t.Errorf("class %s at %v, } at %v", class.Name, class.NamePos, class.Rbrace)
+	}
+	if len(class.VarDecs) != 1 || class.VarDecs[0].Kind != token.FIELD || class.VarDecs[0].Type != "int" || strings.Join(class.VarDecs[0].Names, ",") != "x,y" {
+		t.Fatalf("var decs %+v", class.VarDecs)
+	}
+	if len(class.Subroutines) != 1 {
+		t.Fatalf("%d subroutines, want 1", len(class.Subroutines))
+	}
+	f := class.Subroutines[0]
+	if f.Kind != token.METHOD || f.ReturnType != "int" || f.Name != "f" || len(f.Params) != 2 || f.Params[1].Type != "Array" || f.Params[1].Name != "b" {
+		t.Errorf("subroutine %+v", f)
+	}
+	if f.Pos.Line != 3 || f.Pos.Column != 3 {
+		t.Errorf("subroutine at %v, want line 3 column 3", f.Pos)
+	}
+	if len(f.Body.VarDecs) != 1 || len(f.Body.Statements) != 3 {
+		t.Fatalf("body has %d var decs and %d statements", len(f.Body.VarDecs), len(f.Body.Statements))
+	}
+
+	let, ok := f.Body.Statements[0].(*ast.LetStatement)
+	if !ok || let.Name != "b" || let.Index == nil {
+		t.Fatalf("statement 0 is %#v", f.Body.Statements[0])
+	}
+	// Jack has no precedence: a + 1 * 2 is (a + 1) * 2.
+	mul, ok := let.Value.(*ast.BinaryExpression)
+	if !ok || mul.Op != "*" {
+		t.Fatalf("let value is %#v", let.Value)
+	}
+	add, ok := mul.Left.(*ast.BinaryExpression)
+	if !ok || add.Op != "+" || mul.Position() != add.Left.Position() || add.Left.Position().Column != 16 {
+		t.Errorf("left operand of * is %#v", mul.Left)
+	}
+
+	ifStatement, ok := f.Body.Statements[1].(*ast.IfStatement)
+	if !ok || ifStatement.Else == nil || len(ifStatement.Then.Statements) != 1 || len(ifStatement.Else.Statements) != 1 {
+		t.Fatalf("statement 1 is %#v", f.Body.Statements[1])
+	}
+	if _, ok := ifStatement.Condition.(*ast.UnaryExpression); !ok {
+		t.Errorf("if condition is %#v", ifStatement.Condition)
+	}
+	call := ifStatement.Then.Statements[0].(*ast.DoStatement).Call
+	if call.Receiver != "Output" || call.Name != "printInt" || len(call.Args) != 1 {
+		t.Errorf("then calls %+v", call)
+	}
+	call = ifStatement.Else.Statements[0].(*ast.DoStatement).Call
+	if call.Receiver != "" || call.Name != "g" || len(call.Args) != 0 {
+		t.Errorf("else calls %+v", call)
+	}
+
+	ret, ok := f.Body.Statements[2].(*ast.ReturnStatement)
+	if !ok {
+		t.Fatalf("statement 2 is %#v", f.Body.Statements[2])
+	}
+	if value, ok := ret.Value.(*ast.KeywordConstant); !ok || value.Keyword != token.THIS {
+		t.Errorf("return value is %#v", ret.Value)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{
+			"class Main {\n  function void main() {\n    let x = ;\n    do Output.printInt(1;\n    return;\n  }\n}\n",
+			[]string{"3:13: expected identifier but got ;", "4:25: expected , but got ;"},
+		},
+		{
+			"class Main {\n  field int x y;\n  method void f() { return; }\n  static int 3;\n}\n",
+			[]string{"2:15: expected ; but got y", "4:14: expected identifier but got 3"},
+		},
+		{
+			"class Main {\n  function void main() {\n    if (x) {\n      let y = 1\n    } else {\n      return;\n    }\n    while x { return; }\n  }\n}\n",
+			[]string{"5:5: expected ; but got }", "8:11: expected ( but got x"},
+		},
+		{
+			"class Main {\n  function int f() {\n    let a[1 = 2;\n    return -;\n  }\n}\n",
+			[]string{"3:16: expected ] but got ;", "4:13: expected identifier but got ;"},
+		},
+		// Lexical errors replace the syntax error of their token and are
+		// sorted in with the other errors.
+		{
+			"class Main {\n  function void main() {\n    let s = \"abc\n    let x = 99999;\n    let y = 1 # 2;\n    return;\n  }\n}\n",
+			[]string{"3:13: unterminated string constant", "4:13: integer constant 99999 is larger than 32767", "5:15: illegal character '#'"},
+		},
+		{
+			"class Main {\n  function void main() {\n    let x = 1;\n    do f(é);\n    return;\n  }\n}\n",
+			[]string{"4:10: illegal character 'é'"},
+		},
+		{
+			"class Main {\n  function void main() {\n    /* open\n",
+			[]string{"3:5: unterminated comment", "4:1: unexpected end of file"},
+		},
+		{
+			"class Main {\n  function void main() {\n    return;\n",
+			[]string{"4:1: unexpected end of file"},
+		},
+		{
+			"class Main { } extra",
+			[]string{"1:16: expected end of file but got extra"},
+		},
+	}
+	for _, tt := range tests {
+		_, err := parse(t, tt.src)
+		var list parser.ErrorList
+		if !errors.As(err, &list) {
+			t.Errorf("%q: got %v, want an ErrorList", tt.src, err)
+			continue
+		}
+		var got []string
+		for _, e := range list {
+			got = append(got, strings.TrimPrefix(e.Error(), "Main.jack:"))
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%q:\ngot  %q\nwant %q", tt.src, got, tt.want)
+		}
+	}
+}
@@ -1,8 +1,32 @@
 package token
 
+import "strconv"
+
 type Token struct {
-	Type    TokenType
-	Literal string
+	Type     TokenType
+	Literal  string
+	Pos      Position
+	Comments []Comment // comments between the previous token and this one
+}
+
+// Comment is a // or /* */ comment with its delimiters. The tokenizer keeps
+// comments as trivia of the token that follows them.
+type Comment struct {
+	Text string
+	Pos  Position
+}
+
+// Position locates a token in its file. Line and Column are 1-based, and
+// Column and Offset count bytes.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+	Offset int
+}
+
+func (p Position) String() string {
+	return p.File + ":" + strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Column)
 }
 
 func (token *Token) Xml() string {
@@ -37,6 +61,10 @@ const (
 	IDENTIFIER   TokenType = "IDENTIFIER"
 	INT_CONST    TokenType = "INT_CONST"
 	STRING_CONST TokenType = "STRING_CONST"
+	// ILLEGAL is input that is no token, such as a stray character or an
+	// unterminated string. The tokenizer reports a diagnostic for it.
+	ILLEGAL TokenType = "ILLEGAL"
+	EOF     TokenType = "EOF"
 )
 
 type Keyword string
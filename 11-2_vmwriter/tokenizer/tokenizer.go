@@ -1,124 +1,285 @@
 package tokenizer
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/youchann/nand2tetris/11-2_vmwriter/token"
 )
 
+// MaxInt is the largest integer constant in Jack.
+const MaxInt = 32767
+
+// Diagnostic is a lexical error.
+type Diagnostic struct {
+	Pos     token.Position
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return d.Pos.String() + ": " + d.Message
+}
+
 type JackTokenizer struct {
-	input        string
-	currentToken *token.Token
-	nextPosition int
+	file   string
+	input  string
+	source []string // lines of the input
+	// tokens holds every token scanned so far, tokens[current] being the
+	// current one, so that the parser can look ahead and backtrack.
+	tokens       []*token.Token
+	current      int
+	nextPosition int             // where scanning continues in input
+	comments     []token.Comment // comments before the token being scanned
+	diagnostics  []Diagnostic
+	// line is the line of input[scanned], which starts at lineStart.
+	line      int
+	lineStart int
+	scanned   int
 }
 
-func New(input string) *JackTokenizer {
-	t := &JackTokenizer{input: preprocessCode(input)}
-	t.Advance()
+// New returns a tokenizer for the content of a .jack file. file names the
+// file in token positions.
+func New(file, input string) *JackTokenizer {
+	t := &JackTokenizer{
+		file:         file,
+		input:        input,
+		source:       strings.Split(input, "\n"),
+		tokens:       nil,
+		current:      0,
+		nextPosition: 0,
+		comments:     nil,
+		diagnostics:  nil,
+		line:         1,
+		lineStart:    0,
+		scanned:      0,
+	}
+	t.fill(0)
 	return t
 }
 
+// SourceLine returns the given 1-based line of the input as written,
+// comments included.
+func (t *JackTokenizer) SourceLine(line int) string {
+	if line < 1 || line > len(t.source) {
+		return ""
+	}
+	return strings.TrimSuffix(t.source[line-1], "\r")
+}
+
 func (t *JackTokenizer) CurrentToken() *token.Token {
-	return t.currentToken
+	return t.tokens[t.current]
+}
+
+// Peek returns the token n tokens after the current one without consuming
+// anything; Peek(0) is the current token. Past the end it returns EOF, and
+// before the first token it returns nil.
+func (t *JackTokenizer) Peek(n int) *token.Token {
+	if t.current+n < 0 {
+		return nil
+	}
+	t.fill(t.current + n)
+	return t.tokens[t.current+n]
+}
+
+// Mark returns the current place in the token stream for Reset.
+func (t *JackTokenizer) Mark() int {
+	return t.current
+}
+
+// Reset goes back to a place returned by Mark. The tokens after it are
+// returned again by Advance without being scanned twice.
+func (t *JackTokenizer) Reset(mark int) {
+	t.current = mark
+}
+
+// Comments returns the comments of the tokens scanned so far in source
+// order.
+func (t *JackTokenizer) Comments() []token.Comment {
+	var result []token.Comment
+	for _, tok := range t.tokens {
+		result = append(result, tok.Comments...)
+	}
+	return result
+}
+
+// Diagnostics returns the lexical errors found so far.
+func (t *JackTokenizer) Diagnostics() []Diagnostic {
+	return t.diagnostics
 }
 
 func (t *JackTokenizer) HasMoreTokens() bool {
-	return t.nextPosition < len(t.input)
+	return t.Peek(1).Type != token.EOF
 }
 
+// Advance moves to the next token. At EOF it stays there.
 func (t *JackTokenizer) Advance() {
-	// skip whitespace
-	for t.nextPosition < len(t.input) && (t.input[t.nextPosition] == ' ' || t.input[t.nextPosition] == '\n' || t.input[t.nextPosition] == '\r' || t.input[t.nextPosition] == '\t') {
-		t.nextPosition++
+	if t.CurrentToken().Type == token.EOF {
+		return
 	}
+	t.current++
+	t.fill(t.current)
+}
+
+// fill scans tokens until tokens[i] exists.
+func (t *JackTokenizer) fill(i int) {
+	for len(t.tokens) <= i {
+		t.tokens = append(t.tokens, t.scan())
+	}
+}
+
+// scan returns the next token of the input.
+func (t *JackTokenizer) scan() *token.Token {
+	t.skipWhitespaceAndComments()
 
 	if t.nextPosition == len(t.input) {
-		return
+		return t.newToken(token.EOF, t.nextPosition, "")
 	}
+	start := t.nextPosition
 
 	// keyword or identifier
 	if isLetter(t.input[t.nextPosition]) {
-		start := t.nextPosition
 		for t.nextPosition < len(t.input) && (isLetter(t.input[t.nextPosition]) || isDigit(t.input[t.nextPosition])) {
 			t.nextPosition++
 		}
 		if _, exists := token.KeywordMap[t.input[start:t.nextPosition]]; exists {
-			t.currentToken = &token.Token{
-				Type:    token.KEYWORD,
-				Literal: t.input[start:t.nextPosition],
-			}
-		} else {
-			t.currentToken = &token.Token{
-				Type:    token.IDENTIFIER,
-				Literal: t.input[start:t.nextPosition],
-			}
+			return t.newToken(token.KEYWORD, start, t.input[start:t.nextPosition])
 		}
-		return
+		return t.newToken(token.IDENTIFIER, start, t.input[start:t.nextPosition])
 	}
 
 	// symbol
 	if isSymbol(t.input[t.nextPosition]) {
-		t.currentToken = &token.Token{
-			Type:    token.SYMBOL,
-			Literal: string(t.input[t.nextPosition]),
-		}
 		t.nextPosition++
-		return
+		return t.newToken(token.SYMBOL, start, t.input[start:t.nextPosition])
 	}
 
 	// integer constant
 	if isDigit(t.input[t.nextPosition]) {
-		start := t.nextPosition
 		for t.nextPosition < len(t.input) && isDigit(t.input[t.nextPosition]) {
 			t.nextPosition++
 		}
-		t.currentToken = &token.Token{
-			Type:    token.INT_CONST,
-			Literal: t.input[start:t.nextPosition],
+		if _, err := parseInt(t.input[start:t.nextPosition]); err != nil {
+			t.report(start, err.Error())
 		}
-		return
+		return t.newToken(token.INT_CONST, start, t.input[start:t.nextPosition])
 	}
 
-	// string constant
+	// string constant, which ends on the same line
 	if t.input[t.nextPosition] == '"' {
-		start := t.nextPosition + 1
 		t.nextPosition++
-		for t.nextPosition < len(t.input) && t.input[t.nextPosition] != '"' {
+		for t.nextPosition < len(t.input) && t.input[t.nextPosition] != '"' && t.input[t.nextPosition] != '\n' {
 			t.nextPosition++
 		}
-		t.currentToken = &token.Token{
-			Type:    token.STRING_CONST,
-			Literal: t.input[start:t.nextPosition],
+		if t.nextPosition == len(t.input) || t.input[t.nextPosition] != '"' {
+			t.report(start, "unterminated string constant")
+			return t.newToken(token.ILLEGAL, start, t.input[start:t.nextPosition])
 		}
 		t.nextPosition++
-		return
+		return t.newToken(token.STRING_CONST, start, t.input[start+1:t.nextPosition-1])
+	}
+
+	// A character outside ASCII is reported once, not once per byte.
+	r, size := utf8.DecodeRuneInString(t.input[start:])
+	t.nextPosition += size
+	if r == utf8.RuneError && size == 1 {
+		t.report(start, fmt.Sprintf("invalid UTF-8 byte 0x%02x", t.input[start]))
+	} else {
+		t.report(start, "illegal character "+strconv.QuoteRune(r))
+	}
+	return t.newToken(token.ILLEGAL, start, t.input[start:t.nextPosition])
+}
+
+func (t *JackTokenizer) report(offset int, message string) {
+	t.diagnostics = append(t.diagnostics, Diagnostic{Pos: t.position(offset), Message: message})
+}
+
+// skipWhitespaceAndComments moves past whitespace, // comments and /* */
+// comments, which include /** */ doc comments. The comments are kept for
+// the next token.
+func (t *JackTokenizer) skipWhitespaceAndComments() {
+	for t.nextPosition < len(t.input) {
+		start := t.nextPosition
+		switch {
+		case strings.ContainsRune(" \t\r\n", rune(t.input[t.nextPosition])):
+			t.nextPosition++
+			continue
+		case strings.HasPrefix(t.input[t.nextPosition:], "//"):
+			end := strings.IndexByte(t.input[t.nextPosition:], '\n')
+			if end == -1 {
+				t.nextPosition = len(t.input)
+			} else {
+				t.nextPosition += end
+			}
+		case strings.HasPrefix(t.input[t.nextPosition:], "/*"):
+			end := strings.Index(t.input[t.nextPosition+2:], "*/")
+			if end == -1 {
+				t.report(t.nextPosition, "unterminated comment")
+				t.nextPosition = len(t.input)
+			} else {
+				t.nextPosition += 2 + end + 2
+			}
+		default:
+			return
+		}
+		t.comments = append(t.comments, token.Comment{Text: t.input[start:t.nextPosition], Pos: t.position(start)})
 	}
 }
 
+func (t *JackTokenizer) newToken(typ token.TokenType, start int, literal string) *token.Token {
+	comments := t.comments
+	t.comments = nil
+	return &token.Token{
+		Type:     typ,
+		Literal:  literal,
+		Pos:      t.position(start),
+		Comments: comments,
+	}
+}
+
+// position returns the position of offset, which must not be before the
+// previous offset asked for.
+func (t *JackTokenizer) position(offset int) token.Position {
+	for ; t.scanned < offset; t.scanned++ {
+		if t.input[t.scanned] == '\n' {
+			t.line++
+			t.lineStart = t.scanned + 1
+		}
+	}
+	return token.Position{File: t.file, Line: t.line, Column: offset - t.lineStart + 1, Offset: offset}
+}
+
 func (t *JackTokenizer) TokenType() token.TokenType {
-	return t.currentToken.Type
+	return t.CurrentToken().Type
 }
 
 func (t *JackTokenizer) Keyword() token.Keyword {
-	return token.Keyword(t.currentToken.Literal)
+	return token.Keyword(t.CurrentToken().Literal)
 }
 
 func (t *JackTokenizer) Symbol() token.Symbol {
-	return token.Symbol(t.currentToken.Literal)
+	return token.Symbol(t.CurrentToken().Literal)
 }
 
 func (t *JackTokenizer) Identifier() string {
-	return t.currentToken.Literal
+	return t.CurrentToken().Literal
 }
 
-func (t *JackTokenizer) IntVal() int {
-	v, _ := strconv.Atoi(t.currentToken.Literal) // TODO: handle error
-	return v
+func (t *JackTokenizer) IntVal() (int, error) {
+	return parseInt(t.CurrentToken().Literal)
+}
+
+func parseInt(literal string) (int, error) {
+	v, err := strconv.Atoi(literal)
+	if err != nil || v > MaxInt {
+		return 0, fmt.Errorf("integer constant %s is larger than %d", literal, MaxInt)
+	}
+	return v, nil
 }
 
 func (t *JackTokenizer) StringVal() string {
-	return t.currentToken.Literal
+	return t.CurrentToken().Literal
 }
 
 func isLetter(ch byte) bool {
@@ -132,33 +293,3 @@ func isDigit(ch byte) bool {
 func isSymbol(ch byte) bool {
 	return strings.Contains("{}()[].,;+-*/&|<>=~", string(ch))
 }
-
-func preprocessCode(input string) string {
-	var result strings.Builder
-	i := 0
-	for i < len(input) {
-		// remove multi-line comments
-		if i+1 < len(input) && input[i:i+2] == "/*" {
-			i += 2
-			for i < len(input) {
-				if i+1 < len(input) && input[i:i+2] == "*/" {
-					i += 2
-					break
-				}
-				i++
-			}
-			continue
-		}
-		// remove single-line comments
-		if i+1 < len(input) && input[i:i+2] == "//" {
-			i += 2
-			for i < len(input) && input[i] != '\n' {
-				i++
-			}
-			continue
-		}
-		result.WriteByte(input[i])
-		i++
-	}
-	return result.String()
-}
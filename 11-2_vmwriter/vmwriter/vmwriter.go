@@ -1,89 +1,127 @@
 package vmwriter
 
-import "strconv"
+import (
+	"strings"
 
-type Segment string
+	"github.com/youchann/nand2tetris/vmir"
+)
+
+type Segment = vmir.Segment
 
 const (
-	CONSTANT Segment = "constant"
-	ARGUMENT Segment = "argument"
-	LOCAL    Segment = "local"
-	STATIC   Segment = "static"
-	THIS     Segment = "this"
-	THAT     Segment = "that"
-	POINTER  Segment = "pointer"
-	TEMP     Segment = "temp"
+	CONSTANT = vmir.Constant
+	ARGUMENT = vmir.Argument
+	LOCAL    = vmir.Local
+	STATIC   = vmir.Static
+	THIS     = vmir.This
+	THAT     = vmir.That
+	POINTER  = vmir.Pointer
+	TEMP     = vmir.Temp
 )
 
-type command string
+type command = vmir.Opcode
 
 const (
-	ADD command = "add"
-	SUB command = "sub"
-	NEG command = "neg"
-	EQ  command = "eq"
-	GT  command = "gt"
-	LT  command = "lt"
-	AND command = "and"
-	OR  command = "or"
-	NOT command = "not"
+	ADD = vmir.Add
+	SUB = vmir.Sub
+	NEG = vmir.Neg
+	EQ  = vmir.Eq
+	GT  = vmir.Gt
+	LT  = vmir.Lt
+	AND = vmir.And
+	OR  = vmir.Or
+	NOT = vmir.Not
 )
 
+// SourceMapEntry ties a line of the .vm output to the Jack source it was
+// compiled from.
+type SourceMapEntry struct {
+	VMLine int    `json:"vmLine"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// VMWriter collects the compiled commands both as VM IR and as .vm text.
+// The position of each command is its line in Code.
 type VMWriter struct {
 	Code      string
-	hasIndent bool
+	Commands  []vmir.Command
+	SourceMap []SourceMapEntry
+	lines     int
+	source    SourceMapEntry // Jack position of the commands being written
 }
 
 func New() *VMWriter {
 	return &VMWriter{
 		Code:      "",
-		hasIndent: false,
+		Commands:  nil,
+		SourceMap: nil,
+		lines:     0,
+		source:    SourceMapEntry{},
 	}
 }
 
+// SetSource sets the Jack position recorded in the source map for the
+// commands written next. A line of 0 records nothing.
+func (w *VMWriter) SetSource(file string, line, column int) {
+	w.source = SourceMapEntry{File: file, Line: line, Column: column}
+}
+
+// WriteComment writes a comment line, which is not a command.
+func (w *VMWriter) WriteComment(text string) {
+	w.lines++
+	w.Code += "    // " + text + "\n"
+}
+
 func (w *VMWriter) WritePush(segment Segment, index int) {
-	w.write("push " + string(segment) + " " + strconv.Itoa(index))
+	w.WriteCommand(vmir.Command{Op: vmir.Push, Segment: segment, Index: index})
 }
 
 func (w *VMWriter) WritePop(segment Segment, index int) {
-	w.write("pop " + string(segment) + " " + strconv.Itoa(index))
+	w.WriteCommand(vmir.Command{Op: vmir.Pop, Segment: segment, Index: index})
 }
 
 func (w *VMWriter) WriteArithmetic(command command) {
-	w.write(string(command))
+	w.WriteCommand(vmir.Command{Op: command})
 }
 
 func (w *VMWriter) WriteLabel(label string) {
-	w.hasIndent = false
-	w.write("label " + label)
-	w.hasIndent = true
+	w.WriteCommand(vmir.Command{Op: vmir.Label, Name: label})
 }
 
 func (w *VMWriter) WriteGoto(label string) {
-	w.write("goto " + label)
+	w.WriteCommand(vmir.Command{Op: vmir.Goto, Name: label})
 }
 
 func (w *VMWriter) WriteIf(label string) {
-	w.write("if-goto " + label)
+	w.WriteCommand(vmir.Command{Op: vmir.IfGoto, Name: label})
 }
 
 func (w *VMWriter) WriteCall(name string, nArgs int) {
-	w.write("call " + name + " " + strconv.Itoa(nArgs))
+	w.WriteCommand(vmir.Command{Op: vmir.Call, Name: name, Index: nArgs})
 }
 
 func (w *VMWriter) WriteFunction(name string, nLocals int) {
-	w.hasIndent = false
-	w.write("function " + name + " " + strconv.Itoa(nLocals))
-	w.hasIndent = true
+	w.WriteCommand(vmir.Command{Op: vmir.Function, Name: name, Index: nLocals})
 }
 
 func (w *VMWriter) WriteReturn() {
-	w.write("return")
+	w.WriteCommand(vmir.Command{Op: vmir.Return})
 }
 
-func (w *VMWriter) write(str string) {
-	if w.hasIndent {
-		w.Code += "    "
+// WriteCommand appends command, which makes the VMWriter a vmir.Writer.
+func (w *VMWriter) WriteCommand(command vmir.Command) error {
+	w.lines++
+	command.Pos.Line = w.lines
+	w.Commands = append(w.Commands, command)
+	if w.source.Line > 0 {
+		entry := w.source
+		entry.VMLine = w.lines
+		w.SourceMap = append(w.SourceMap, entry)
 	}
-	w.Code += str + "\n"
+	var b strings.Builder
+	vmir.NewPrinter(&b).WriteCommand(command)
+	w.Code += b.String()
+	return nil
 }
@@ -0,0 +1,295 @@
+// Package xmlwriter writes the syntax tree of a class as the XML parse tree
+// of chapter 10.
+package xmlwriter
+
+import (
+	"strconv"
+
+	"github.com/youchann/nand2tetris/11-2_vmwriter/ast"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/token"
+)
+
+// XMLWriter is an ast.Visitor that collects the XML of the nodes it visits.
+type XMLWriter struct {
+	XML    string
+	indent int
+}
+
+func New() *XMLWriter {
+	return &XMLWriter{
+		XML:    "",
+		indent: 0,
+	}
+}
+
+func (w *XMLWriter) VisitClass(n *ast.Class) {
+	w.open("class")
+	w.keyword("class")
+	w.identifier(n.Name)
+	w.symbol("{")
+	for _, dec := range n.VarDecs {
+		dec.Accept(w)
+	}
+	for _, dec := range n.Subroutines {
+		dec.Accept(w)
+	}
+	w.symbol("}")
+	w.close("class")
+}
+
+func (w *XMLWriter) VisitClassVarDec(n *ast.ClassVarDec) {
+	w.open("classVarDec")
+	w.keyword(string(n.Kind))
+	w.typ(n.Type)
+	w.names(n.Names)
+	w.symbol(";")
+	w.close("classVarDec")
+}
+
+func (w *XMLWriter) VisitSubroutineDec(n *ast.SubroutineDec) {
+	w.open("subroutineDec")
+	w.keyword(string(n.Kind))
+	w.typ(n.ReturnType)
+	w.identifier(n.Name)
+
+	w.symbol("(")
+	w.open("parameterList")
+	for i, param := range n.Params {
+		if i > 0 {
+			w.symbol(",")
+		}
+		w.typ(param.Type)
+		w.identifier(param.Name)
+	}
+	w.close("parameterList")
+	w.symbol(")")
+
+	w.open("subroutineBody")
+	w.symbol("{")
+	for _, dec := range n.Body.VarDecs {
+		w.open("varDec")
+		w.keyword("var")
+		w.typ(dec.Type)
+		w.names(dec.Names)
+		w.symbol(";")
+		w.close("varDec")
+	}
+	w.statements(n.Body.Statements)
+	w.symbol("}")
+	w.close("subroutineBody")
+
+	w.close("subroutineDec")
+}
+
+func (w *XMLWriter) VisitLetStatement(n *ast.LetStatement) {
+	w.open("letStatement")
+	w.keyword("let")
+	w.identifier(n.Name)
+	if n.Index != nil {
+		w.symbol("[")
+		w.expression(n.Index)
+		w.symbol("]")
+	}
+	w.symbol("=")
+	w.expression(n.Value)
+	w.symbol(";")
+	w.close("letStatement")
+}
+
+func (w *XMLWriter) VisitIfStatement(n *ast.IfStatement) {
+	w.open("ifStatement")
+	w.keyword("if")
+	w.symbol("(")
+	w.expression(n.Condition)
+	w.symbol(")")
+	w.block(n.Then)
+	if n.Else != nil {
+		w.keyword("else")
+		w.block(n.Else)
+	}
+	w.close("ifStatement")
+}
+
+func (w *XMLWriter) VisitWhileStatement(n *ast.WhileStatement) {
+	w.open("whileStatement")
+	w.keyword("while")
+	w.symbol("(")
+	w.expression(n.Condition)
+	w.symbol(")")
+	w.block(n.Body)
+	w.close("whileStatement")
+}
+
+func (w *XMLWriter) VisitDoStatement(n *ast.DoStatement) {
+	w.open("doStatement")
+	w.keyword("do")
+	w.call(n.Call)
+	w.symbol(";")
+	w.close("doStatement")
+}
+
+func (w *XMLWriter) VisitReturnStatement(n *ast.ReturnStatement) {
+	w.open("returnStatement")
+	w.keyword("return")
+	if n.Value != nil {
+		w.expression(n.Value)
+	}
+	w.symbol(";")
+	w.close("returnStatement")
+}
+
+func (w *XMLWriter) VisitIntegerConstant(n *ast.IntegerConstant) {
+	w.open("term")
+	w.token(token.INT_CONST, strconv.Itoa(n.Value))
+	w.close("term")
+}
+
+func (w *XMLWriter) VisitStringConstant(n *ast.StringConstant) {
+	w.open("term")
+	w.token(token.STRING_CONST, n.Value)
+	w.close("term")
+}
+
+func (w *XMLWriter) VisitKeywordConstant(n *ast.KeywordConstant) {
+	w.open("term")
+	w.keyword(string(n.Keyword))
+	w.close("term")
+}
+
+func (w *XMLWriter) VisitVarName(n *ast.VarName) {
+	w.open("term")
+	w.identifier(n.Name)
+	w.close("term")
+}
+
+func (w *XMLWriter) VisitArrayElement(n *ast.ArrayElement) {
+	w.open("term")
+	w.identifier(n.Name)
+	w.symbol("[")
+	w.expression(n.Index)
+	w.symbol("]")
+	w.close("term")
+}
+
+func (w *XMLWriter) VisitCallExpression(n *ast.CallExpression) {
+	w.open("term")
+	w.call(n)
+	w.close("term")
+}
+
+func (w *XMLWriter) VisitUnaryExpression(n *ast.UnaryExpression) {
+	w.open("term")
+	w.symbol(string(n.Op))
+	n.Operand.Accept(w)
+	w.close("term")
+}
+
+// VisitBinaryExpression writes the terms and operators of a chain of binary
+// expressions side by side, as they appear in an expression element.
+func (w *XMLWriter) VisitBinaryExpression(n *ast.BinaryExpression) {
+	n.Left.Accept(w)
+	w.symbol(string(n.Op))
+	n.Right.Accept(w)
+}
+
+func (w *XMLWriter) VisitParenExpression(n *ast.ParenExpression) {
+	w.open("term")
+	w.symbol("(")
+	w.expression(n.Expression)
+	w.symbol(")")
+	w.close("term")
+}
+
+func (w *XMLWriter) expression(e ast.Expression) {
+	w.open("expression")
+	e.Accept(w)
+	w.close("expression")
+}
+
+// call writes a subroutine call, which is a term in expressions but not in
+// do statements.
+func (w *XMLWriter) call(n *ast.CallExpression) {
+	if n.Receiver != "" {
+		w.identifier(n.Receiver)
+		w.symbol(".")
+	}
+	w.identifier(n.Name)
+	w.symbol("(")
+	w.open("expressionList")
+	for i, arg := range n.Args {
+		if i > 0 {
+			w.symbol(",")
+		}
+		w.expression(arg)
+	}
+	w.close("expressionList")
+	w.symbol(")")
+}
+
+func (w *XMLWriter) block(b *ast.Block) {
+	w.symbol("{")
+	w.statements(b.Statements)
+	w.symbol("}")
+}
+
+func (w *XMLWriter) statements(statements []ast.Statement) {
+	w.open("statements")
+	for _, statement := range statements {
+		statement.Accept(w)
+	}
+	w.close("statements")
+}
+
+func (w *XMLWriter) names(names []string) {
+	for i, name := range names {
+		if i > 0 {
+			w.symbol(",")
+		}
+		w.identifier(name)
+	}
+}
+
+// typ writes a type or void, which is a keyword for the built-in types and
+// an identifier for classes.
+func (w *XMLWriter) typ(name string) {
+	if _, ok := token.KeywordMap[name]; ok {
+		w.keyword(name)
+	} else {
+		w.identifier(name)
+	}
+}
+
+func (w *XMLWriter) keyword(literal string) {
+	w.token(token.KEYWORD, literal)
+}
+
+func (w *XMLWriter) symbol(literal string) {
+	w.token(token.SYMBOL, literal)
+}
+
+func (w *XMLWriter) identifier(literal string) {
+	w.token(token.IDENTIFIER, literal)
+}
+
+func (w *XMLWriter) token(typ token.TokenType, literal string) {
+	t := token.Token{Type: typ, Literal: literal}
+	w.print(t.Xml())
+}
+
+func (w *XMLWriter) open(tag string) {
+	w.print("<" + tag + ">")
+	w.indent++
+}
+
+func (w *XMLWriter) close(tag string) {
+	w.indent--
+	w.print("</" + tag + ">")
+}
+
+func (w *XMLWriter) print(str string) {
+	indentation := ""
+	for i := 0; i < w.indent; i++ {
+		indentation += "  "
+	}
+	w.XML += indentation + str + "\n"
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/youchann/nand2tetris/06/assembler"
+	"github.com/youchann/nand2tetris/08/callgraph"
+	"github.com/youchann/nand2tetris/08/codewriter"
+	vmtoken "github.com/youchann/nand2tetris/08/token"
+	"github.com/youchann/nand2tetris/08/translator"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/compilationengine"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/tokenizer"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/vmwriter"
+	"github.com/youchann/nand2tetris/vmir"
+)
+
+// class is a compiled Jack class.
+type class struct {
+	name     string
+	code     string
+	commands []vmir.Command
+}
+
+func main() {
+	outDir := flag.String("o", "", "output directory (default: <project>/build)")
+	osDir := flag.String("os", "", "directory of OS .jack sources to link, such as ../12")
+	optimize := flag.Bool("optimize", true, "share routines, fuse commands and drop unreachable functions so that programs with the OS fit in ROM")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Println("Usage: go run main.go [flags] [project directory]")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	project := flag.Arg(0)
+	fileInfo, err := os.Stat(project)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error accessing path: %v\n", err)
+		os.Exit(1)
+	}
+	if !fileInfo.IsDir() {
+		fmt.Fprintf(os.Stderr, "Error: %s is not a directory\n", project)
+		os.Exit(1)
+	}
+	absProject, err := filepath.Abs(project)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error accessing path: %v\n", err)
+		os.Exit(1)
+	}
+	name := filepath.Base(absProject)
+	if *outDir == "" {
+		*outDir = filepath.Join(project, "build")
+	}
+
+	classes, err := compile(project, *osDir)
+	if err != nil {
+		fail("compile", err)
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
+		os.Exit(1)
+	}
+	for _, c := range classes {
+		if err := os.WriteFile(filepath.Join(*outDir, c.name+".vm"), []byte(c.code), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s.vm: %v\n", c.name, err)
+			os.Exit(1)
+		}
+	}
+
+	asm, err := translate(classes, *optimize)
+	if err != nil {
+		fail("translate", err)
+	}
+	asmPath := filepath.Join(*outDir, name+".asm")
+	if err := os.WriteFile(asmPath, asm, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", asmPath, err)
+		os.Exit(1)
+	}
+
+	machineCode, _, _, err := assembler.Assemble(string(asm))
+	if err != nil {
+		fail("assemble", err)
+	}
+	hackPath := filepath.Join(*outDir, name+".hack")
+	if err := os.WriteFile(hackPath, []byte(strings.Join(machineCode, "\n")+"\n"), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", hackPath, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Built %s from %d classes, %d ROM words\n", hackPath, len(classes), len(machineCode))
+}
+
+// fail reports the error of a build stage and exits.
+func fail(stage string, err error) {
+	fmt.Fprintf(os.Stderr, "Error: %s: %v\n", stage, err)
+	os.Exit(1)
+}
+
+// compile compiles the .jack files of the project and, if osDir is set, the
+// OS classes that the project does not define itself.
+func compile(project, osDir string) ([]class, error) {
+	paths, err := jackFiles(project)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no .jack files found in %s", project)
+	}
+	if osDir != "" {
+		osFiles, err := jackFiles(osDir)
+		if err != nil {
+			return nil, err
+		}
+		defined := map[string]bool{}
+		for _, path := range paths {
+			defined[filepath.Base(path)] = true
+		}
+		for _, path := range osFiles {
+			if !defined[filepath.Base(path)] {
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	var classes []class
+	for _, path := range paths {
+		c, err := compileClass(path)
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, c)
+	}
+	return classes, nil
+}
+
+func jackFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading directory: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) == ".jack" {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// compileClass compiles one .jack file. Its errors are listed one per line
+// with their positions.
+func compileClass(path string) (class, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return class{}, fmt.Errorf("reading file %s: %w", path, err)
+	}
+	c := class{name: strings.TrimSuffix(filepath.Base(path), ".jack")}
+	w := vmwriter.New()
+	if err := compilationengine.New(c.name, tokenizer.New(filepath.Base(path), string(content)), w).CompileClass(); err != nil {
+		return class{}, err
+	}
+	c.code = w.Code
+	c.commands = w.Commands
+	return c, nil
+}
+
+// translate turns the compiled classes into Hack assembly. It fails if a
+// called function is not defined anywhere or if the program does not fit in
+// ROM.
+func translate(classes []class, optimize bool) ([]byte, error) {
+	var files []vmtoken.File
+	for _, c := range classes {
+		files = append(files, vmtoken.NewFile(c.name, c.commands))
+	}
+	if err := checkCalls(files); err != nil {
+		return nil, err
+	}
+
+	layout := codewriter.DefaultLayout()
+	layout.Bootstrap = callgraph.New(files).Function(layout.Entry) != nil
+	if optimize {
+		files = translator.Optimize(files)
+		if layout.Bootstrap {
+			files, _ = callgraph.EliminateDeadFunctions(files, layout.Entry)
+		}
+	}
+
+	var asm bytes.Buffer
+	c, err := translator.Translate(&asm, files, codewriter.Options{SharedRoutines: optimize, Layout: layout})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.CheckStatics(); err != nil {
+		return nil, err
+	}
+	if c.ROMSize() > codewriter.ROMCapacity {
+		return nil, fmt.Errorf("program needs %d ROM words, but the ROM holds %d", c.ROMSize(), codewriter.ROMCapacity)
+	}
+	return asm.Bytes(), nil
+}
+
+func checkCalls(files []vmtoken.File) error {
+	g := callgraph.New(files)
+	for _, f := range g.Functions {
+		for _, callee := range g.Calls[f.Name] {
+			if g.Function(callee) == nil {
+				return fmt.Errorf("%s.vm: %s calls undefined function %s", f.File, f.Name, callee)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around each change.
+const contextLines = 3
+
+type edit struct {
+	op   byte // ' ', '-' or '+'
+	line string
+	a, b int // lines of the old and the new text before this edit
+}
+
+// diff returns the unified diff from the content of path before formatting
+// to after, or "" if they are equal.
+func diff(path string, before, after []byte) string {
+	if string(before) == string(after) {
+		return ""
+	}
+	edits := lineEdits(splitLines(string(before)), splitLines(string(after)))
+
+	var result []string
+	result = append(result, "--- "+path+".orig", "+++ "+path)
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			i++
+			continue
+		}
+		// a hunk takes changes that are at most two contexts apart
+		start := max(i-contextLines, 0)
+		last := i
+		for j := i; j < len(edits); j++ {
+			if edits[j].op != ' ' {
+				if j-last-1 > 2*contextLines {
+					break
+				}
+				last = j
+			}
+		}
+		end := min(last+1+contextLines, len(edits))
+
+		var oldLen, newLen int
+		var lines []string
+		for _, e := range edits[start:end] {
+			if e.op != '+' {
+				oldLen++
+			}
+			if e.op != '-' {
+				newLen++
+			}
+			lines = append(lines, string(e.op)+e.line)
+		}
+		result = append(result, fmt.Sprintf("@@ -%s +%s @@", hunkRange(edits[start].a, oldLen), hunkRange(edits[start].b, newLen)))
+		result = append(result, lines...)
+		i = end
+	}
+	return strings.Join(result, "\n") + "\n"
+}
+
+// hunkRange formats the lines of a hunk that follow line.
+func hunkRange(line, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", line)
+	}
+	return fmt.Sprintf("%d,%d", line+1, n)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// lineEdits turns a into b through a longest common subsequence of lines.
+func lineEdits(a, b []string) []edit {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and
+	// b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i], i, j})
+			i++
+			j++
+		case j == len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{'-', a[i], i, j})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j], i, j})
+			j++
+		}
+	}
+	return edits
+}
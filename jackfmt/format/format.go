@@ -0,0 +1,377 @@
+// Package format prints Jack classes in the canonical layout: four spaces per
+// level, one declaration or statement per line, single spaces around binary
+// operators and after commas, and at most one blank line in a row. Comments
+// are kept where they were relative to the code.
+package format
+
+import (
+	"bytes"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/youchann/nand2tetris/11-2_vmwriter/ast"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/parser"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/token"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/tokenizer"
+)
+
+const indentation = "    "
+
+// Source formats the content of a .jack file. file names the file in error
+// positions. It fails with a parser.ErrorList if src has lexical or syntax
+// errors. The result ends its lines with \r\n if the first line of src does.
+func Source(file string, src []byte) ([]byte, error) {
+	t := tokenizer.New(file, string(src))
+	class, err := parser.New(t).ParseClass()
+	if err != nil {
+		return nil, err
+	}
+
+	// the parser has scanned the whole file, so this reads no new tokens
+	var tokens []*token.Token
+	t.Reset(0)
+	for i := 0; len(tokens) == 0 || tokens[len(tokens)-1].Type != token.EOF; i++ {
+		tokens = append(tokens, t.Peek(i))
+	}
+
+	p := &printer{
+		tokenizer:    t,
+		tokens:       tokens,
+		comments:     t.Comments(),
+		lines:        nil,
+		indent:       0,
+		atBlockStart: true,
+		forceBlank:   false,
+	}
+	class.Accept(p)
+	newline := "\n"
+	if i := bytes.IndexByte(src, '\n'); i > 0 && src[i-1] == '\r' {
+		newline = "\r\n"
+	}
+	return []byte(strings.Join(p.lines, newline) + newline), nil
+}
+
+// printer is an ast.Visitor that prints the nodes it visits as lines.
+type printer struct {
+	tokenizer *tokenizer.JackTokenizer
+	tokens    []*token.Token  // every token of the file, EOF last
+	comments  []token.Comment // comments not printed yet
+	lines     []string
+	line      strings.Builder // the line being printed
+	indent    int
+	// atBlockStart is set after a { and suppresses a blank line.
+	atBlockStart bool
+	// forceBlank requests a blank line before the next line.
+	forceBlank bool
+	// trailing is the comment at the end of the last line and
+	// trailingColumn its column there, or 0 if there is none. Comments
+	// aligned with it on the source lines below continue it.
+	trailing       token.Comment
+	trailingColumn int
+}
+
+func (p *printer) VisitClass(n *ast.Class) {
+	p.item(n.Pos, func() {
+		p.beginLine()
+		p.write("class " + n.Name + " {")
+		p.endLine()
+	})
+	p.indent++
+	p.atBlockStart = true
+	for _, dec := range n.VarDecs {
+		p.item(dec.Pos, func() { dec.Accept(p) })
+	}
+	for _, dec := range n.Subroutines {
+		p.forceBlank = true
+		p.item(dec.Pos, func() { dec.Accept(p) })
+	}
+	p.closeBlock(n.Rbrace)
+	p.endLine()
+
+	// comments after the class
+	p.flush(token.Position{Offset: math.MaxInt})
+}
+
+func (p *printer) VisitClassVarDec(n *ast.ClassVarDec) {
+	p.beginLine()
+	p.write(string(n.Kind) + " " + n.Type + " " + strings.Join(n.Names, ", ") + ";")
+	p.endLine()
+}
+
+func (p *printer) VisitSubroutineDec(n *ast.SubroutineDec) {
+	p.beginLine()
+	p.write(string(n.Kind) + " " + n.ReturnType + " " + n.Name + "(")
+	for i, param := range n.Params {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.write(param.Type + " " + param.Name)
+	}
+	p.write(") {")
+	p.endLine()
+
+	p.indent++
+	p.atBlockStart = true
+	for _, dec := range n.Body.VarDecs {
+		p.item(dec.Pos, func() {
+			p.beginLine()
+			p.write("var " + dec.Type + " " + strings.Join(dec.Names, ", ") + ";")
+			p.endLine()
+		})
+	}
+	p.statements(n.Body.Statements)
+	p.closeBlock(n.Body.Rbrace)
+	p.endLine()
+}
+
+func (p *printer) VisitLetStatement(n *ast.LetStatement) {
+	p.beginLine()
+	p.write("let " + n.Name)
+	if n.Index != nil {
+		p.write("[")
+		n.Index.Accept(p)
+		p.write("]")
+	}
+	p.write(" = ")
+	n.Value.Accept(p)
+	p.write(";")
+	p.endLine()
+}
+
+func (p *printer) VisitIfStatement(n *ast.IfStatement) {
+	p.beginLine()
+	p.write("if (")
+	n.Condition.Accept(p)
+	p.write(") ")
+	p.block(n.Then)
+	if n.Else != nil {
+		p.write(" else ")
+		p.block(n.Else)
+	}
+	p.endLine()
+}
+
+func (p *printer) VisitWhileStatement(n *ast.WhileStatement) {
+	p.beginLine()
+	p.write("while (")
+	n.Condition.Accept(p)
+	p.write(") ")
+	p.block(n.Body)
+	p.endLine()
+}
+
+func (p *printer) VisitDoStatement(n *ast.DoStatement) {
+	p.beginLine()
+	p.write("do ")
+	n.Call.Accept(p)
+	p.write(";")
+	p.endLine()
+}
+
+func (p *printer) VisitReturnStatement(n *ast.ReturnStatement) {
+	p.beginLine()
+	p.write("return")
+	if n.Value != nil {
+		p.write(" ")
+		n.Value.Accept(p)
+	}
+	p.write(";")
+	p.endLine()
+}
+
+func (p *printer) VisitIntegerConstant(n *ast.IntegerConstant) {
+	p.write(strconv.Itoa(n.Value))
+}
+
+func (p *printer) VisitStringConstant(n *ast.StringConstant) {
+	p.write(`"` + n.Value + `"`)
+}
+
+func (p *printer) VisitKeywordConstant(n *ast.KeywordConstant) {
+	p.write(string(n.Keyword))
+}
+
+func (p *printer) VisitVarName(n *ast.VarName) {
+	p.write(n.Name)
+}
+
+func (p *printer) VisitArrayElement(n *ast.ArrayElement) {
+	p.write(n.Name + "[")
+	n.Index.Accept(p)
+	p.write("]")
+}
+
+func (p *printer) VisitCallExpression(n *ast.CallExpression) {
+	if n.Receiver != "" {
+		p.write(n.Receiver + ".")
+	}
+	p.write(n.Name + "(")
+	for i, arg := range n.Args {
+		if i > 0 {
+			p.write(", ")
+		}
+		arg.Accept(p)
+	}
+	p.write(")")
+}
+
+func (p *printer) VisitUnaryExpression(n *ast.UnaryExpression) {
+	p.write(string(n.Op))
+	n.Operand.Accept(p)
+}
+
+func (p *printer) VisitBinaryExpression(n *ast.BinaryExpression) {
+	n.Left.Accept(p)
+	p.write(" " + string(n.Op) + " ")
+	n.Right.Accept(p)
+}
+
+func (p *printer) VisitParenExpression(n *ast.ParenExpression) {
+	p.write("(")
+	n.Expression.Accept(p)
+	p.write(")")
+}
+
+// block prints { and the statements of b on their own lines, and leaves the
+// line of the closing } open for an else.
+func (p *printer) block(b *ast.Block) {
+	p.write("{")
+	p.endLine()
+	p.indent++
+	p.atBlockStart = true
+	p.statements(b.Statements)
+	p.closeBlock(b.Rbrace)
+}
+
+func (p *printer) statements(statements []ast.Statement) {
+	for _, statement := range statements {
+		p.item(statement.Position(), func() { statement.Accept(p) })
+	}
+}
+
+// closeBlock prints the comments before the } at rbrace inside the block and
+// begins the line of the }.
+func (p *printer) closeBlock(rbrace token.Position) {
+	p.flush(rbrace)
+	p.indent--
+	p.atBlockStart = false
+	p.beginLine()
+	p.write("}")
+}
+
+// item prints the comments before pos, then a blank line if the source has
+// one before pos, and then calls print for the code at pos. Comments inside
+// that code up to its ; or { cannot stay where they are, since the code is
+// printed on one line, and go on lines of their own before it.
+func (p *printer) item(pos token.Position, print func()) {
+	p.flush(pos)
+	i := p.tokenIndex(pos)
+	if i > 0 && p.tokens[i-1].Pos.Line == pos.Line {
+		// only code that starts a source line can follow a blank line
+		p.separate(0)
+	} else {
+		p.separate(pos.Line)
+	}
+	end := p.end(i)
+	for len(p.comments) > 0 && p.comments[0].Pos.Offset < end {
+		p.trailingColumn = 0
+		p.ownLine(p.comments[0])
+		p.comments = p.comments[1:]
+	}
+	print()
+}
+
+// tokenIndex returns the index of the token at pos.
+func (p *printer) tokenIndex(pos token.Position) int {
+	i, _ := slices.BinarySearchFunc(p.tokens, pos.Offset, func(t *token.Token, offset int) int { return t.Pos.Offset - offset })
+	return i
+}
+
+// end returns the offset of the first ; or { outside parentheses and
+// brackets from the token at index i, which ends the line of the code there.
+func (p *printer) end(i int) int {
+	start := p.tokens[i].Pos.Offset
+	depth := 0
+	for ; i < len(p.tokens); i++ {
+		switch p.tokens[i].Literal {
+		case "(", "[":
+			depth++
+		case ")", "]":
+			depth--
+		case ";", "{":
+			if depth <= 0 && p.tokens[i].Type == token.SYMBOL {
+				return p.tokens[i].Pos.Offset
+			}
+		}
+	}
+	return start
+}
+
+// flush prints the comments before pos. A comment that follows code on its
+// line stays at the end of the last line, and so do the comments aligned
+// with it on the lines below; the others get lines of their own.
+func (p *printer) flush(pos token.Position) {
+	for len(p.comments) > 0 && p.comments[0].Pos.Offset < pos.Offset {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+		before := p.tokenizer.SourceLine(c.Pos.Line)[:c.Pos.Column-1]
+		text := strings.TrimRight(c.Text, " \t\r")
+		if strings.TrimSpace(before) != "" && !strings.Contains(c.Text, "\n") && len(p.lines) > 0 {
+			p.trailing = c
+			p.trailingColumn = len(p.lines[len(p.lines)-1]) + 1
+			p.lines[len(p.lines)-1] += " " + text
+			continue
+		}
+		if p.trailingColumn > 0 && c.Pos.Line == p.trailing.Pos.Line+1 && c.Pos.Column == p.trailing.Pos.Column && !strings.Contains(c.Text, "\n") {
+			p.trailing = c
+			p.lines = append(p.lines, strings.Repeat(" ", p.trailingColumn)+text)
+			continue
+		}
+		p.trailingColumn = 0
+		p.separate(c.Pos.Line)
+		p.ownLine(c)
+	}
+}
+
+// ownLine prints c at the current indentation on lines of its own.
+func (p *printer) ownLine(c token.Comment) {
+	before := p.tokenizer.SourceLine(c.Pos.Line)[:c.Pos.Column-1]
+	for i, line := range strings.Split(c.Text, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if i > 0 {
+			// keep the layout of block comments relative to their start
+			line = strings.TrimPrefix(line, before)
+		}
+		if line == "" {
+			p.lines = append(p.lines, "")
+			continue
+		}
+		p.lines = append(p.lines, strings.Repeat(indentation, p.indent)+line)
+	}
+}
+
+// separate prints a blank line if the source line before line is blank or a
+// blank line was requested, except at the start of a block.
+func (p *printer) separate(line int) {
+	if !p.atBlockStart && (p.forceBlank || line > 1 && strings.TrimSpace(p.tokenizer.SourceLine(line-1)) == "") {
+		p.lines = append(p.lines, "")
+	}
+	p.atBlockStart = false
+	p.forceBlank = false
+}
+
+func (p *printer) beginLine() {
+	p.line.Reset()
+	p.line.WriteString(strings.Repeat(indentation, p.indent))
+}
+
+func (p *printer) write(s string) {
+	p.line.WriteString(s)
+}
+
+func (p *printer) endLine() {
+	p.lines = append(p.lines, p.line.String())
+	p.line.Reset()
+}
@@ -0,0 +1,126 @@
+package format_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/youchann/nand2tetris/11-2_vmwriter/token"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/tokenizer"
+	"github.com/youchann/nand2tetris/jackfmt/format"
+)
+
+// lexemes returns the tokens of src and its comments with all whitespace
+// removed, which formatting must not change.
+func lexemes(src []byte) (tokens, comments []string) {
+	t := tokenizer.New("", string(src))
+	for ; t.CurrentToken().Type != token.EOF; t.Advance() {
+		tokens = append(tokens, t.CurrentToken().Literal)
+	}
+	for _, c := range t.Comments() {
+		comments = append(comments, strings.Join(strings.Fields(c.Text), ""))
+	}
+	return tokens, comments
+}
+
+// TestOSFiles formats the operating system classes of project 12 and checks
+// that their tokens and comments are kept and that formatting the result
+// again changes nothing.
+func TestOSFiles(t *testing.T) {
+	paths, err := filepath.Glob("../../12/*.jack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no .jack files in ../../12")
+	}
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		formatted, err := format.Source(path, src)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		tokens, comments := lexemes(src)
+		gotTokens, gotComments := lexemes(formatted)
+		if !slices.Equal(gotTokens, tokens) {
+			t.Errorf("%s: tokens changed", path)
+		}
+		if !slices.Equal(gotComments, comments) {
+			t.Errorf("%s: comments changed", path)
+		}
+		again, err := format.Source(path, formatted)
+		if err != nil {
+			t.Errorf("%s: formatted source: %v", path, err)
+			continue
+		}
+		if string(again) != string(formatted) {
+			t.Errorf("%s: formatting is not idempotent", path)
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "layout",
+			src:  "class Main{field int x,y;\n\n\n\nmethod void f(int a,int b){let x=a+(b*2);do Output.printInt(-x);return;}}",
+			want: "class Main {\n    field int x, y;\n\n    method void f(int a, int b) {\n        let x = a + (b * 2);\n        do Output.printInt(-x);\n        return;\n    }\n}\n",
+		},
+		{
+			name: "doc comments",
+			src:  "// header\n/**\n * A class.\n */\nclass Main {\n  /** Returns 1.\n   *  Always.\n   */\n  function int one() {\n    return 1;\n  }\n}\n",
+			want: "// header\n/**\n * A class.\n */\nclass Main {\n    /** Returns 1.\n     *  Always.\n     */\n    function int one() {\n        return 1;\n    }\n}\n",
+		},
+		{
+			name: "comments in blocks",
+			src:  "class Main {\n  function void f() {\n    // first\n\n    // second\n    return;\n    // at the end\n  }\n}\n",
+			want: "class Main {\n    function void f() {\n        // first\n\n        // second\n        return;\n        // at the end\n    }\n}\n",
+		},
+		{
+			name: "trailing comments",
+			src:  "class Main {\n  static int n;       // bits\n  static Array twos;  // powers\n                      // of two\n  function void f() { // f\n    return;  // done\n  }\n} // end\n",
+			want: "class Main {\n    static int n; // bits\n    static Array twos; // powers\n                       // of two\n\n    function void f() { // f\n        return; // done\n    }\n} // end\n",
+		},
+		{
+			name: "comments inside statements",
+			src:  "class Main {\n  function void f() {\n    let y = g(1,\n      // inside args\n      2);\n    let x = 1 /* mid */ + 2;\n    if (x /* c */ = 1) { // open\n      return;\n    }\n    return;\n  }\n}\n",
+			want: "class Main {\n    function void f() {\n        // inside args\n        let y = g(1, 2);\n        /* mid */\n        let x = 1 + 2;\n        /* c */\n        if (x = 1) { // open\n            return;\n        }\n        return;\n    }\n}\n",
+		},
+		{
+			name: "CRLF",
+			src:  "class Main {\r\n  // c\r\n  function void f() {\r\n    return; // done\r\n  }\r\n}\r\n",
+			want: "class Main {\r\n    // c\r\n    function void f() {\r\n        return; // done\r\n    }\r\n}\r\n",
+		},
+	}
+	for _, tt := range tests {
+		got, err := format.Source("Main.jack", []byte(tt.src))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s:\ngot\n%s\nwant\n%s", tt.name, got, tt.want)
+			continue
+		}
+		again, err := format.Source("Main.jack", got)
+		if err != nil || string(again) != string(got) {
+			t.Errorf("%s: formatting is not idempotent", tt.name)
+		}
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	if _, err := format.Source("Main.jack", []byte("class Main {\n  function void f() {\n    let x = ;\n  }\n}\n")); err == nil {
+		t.Error("no error for a syntax error")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/youchann/nand2tetris/jackfmt/format"
+)
+
+func main() {
+	write := flag.Bool("w", false, "write the result to the source file instead of standard output")
+	showDiff := flag.Bool("d", false, "print diffs instead of the formatted source")
+	flag.Usage = func() {
+		fmt.Println("Usage: go run main.go [flags] [filename.jack or directory ...]")
+		fmt.Println("With no arguments, jackfmt formats standard input.")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		if *write {
+			fmt.Fprintf(os.Stderr, "Error: cannot use -w with standard input\n")
+			os.Exit(1)
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading standard input: %v\n", err)
+			os.Exit(1)
+		}
+		if err := processFile("<standard input>", src, false, *showDiff); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var jackFiles []string
+	for _, path := range flag.Args() {
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error accessing path: %v\n", err)
+			os.Exit(1)
+		}
+		if !fileInfo.IsDir() {
+			jackFiles = append(jackFiles, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading directory: %v\n", err)
+			os.Exit(1)
+		}
+		for _, entry := range entries {
+			if filepath.Ext(entry.Name()) == ".jack" {
+				jackFiles = append(jackFiles, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	// format every file and report the ones that fail at the end
+	failed := false
+	for _, path := range jackFiles {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		if err := processFile(path, src, *write, *showDiff); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// processFile formats src, the content of path, and prints it, its diff, or
+// writes it back to path.
+func processFile(path string, src []byte, write, showDiff bool) error {
+	res, err := format.Source(filepath.Base(path), src)
+	if err != nil {
+		return err
+	}
+	if showDiff {
+		fmt.Print(diff(filepath.ToSlash(path), src, res))
+	}
+	if write {
+		if bytes.Equal(src, res) {
+			return nil
+		}
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, res, fileInfo.Mode().Perm())
+	}
+	if !showDiff {
+		os.Stdout.Write(res)
+	}
+	return nil
+}
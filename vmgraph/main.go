@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/youchann/nand2tetris/08/callgraph"
+	"github.com/youchann/nand2tetris/08/token"
+	"github.com/youchann/nand2tetris/08/translator"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/compilationengine"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/tokenizer"
+	"github.com/youchann/nand2tetris/11-2_vmwriter/vmwriter"
+)
+
+func main() {
+	format := flag.String("format", "dot", "output format: dot or json")
+	output := flag.String("o", "", "output file (default: standard output)")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Println("Usage: go run main.go [flags] [directory of .vm or .jack files]")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	if *format != "dot" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: -format must be dot or json\n")
+		os.Exit(1)
+	}
+
+	files, err := readProgram(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+	g := callgraph.New(files)
+	if *format == "json" {
+		err = g.WriteJSON(out)
+	} else {
+		err = g.WriteDOT(out)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing call graph: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// readProgram parses the .vm files of dir, or compiles its .jack files if
+// it has no .vm files.
+func readProgram(dir string) ([]token.File, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading directory: %w", err)
+	}
+	var vmFiles, jackFiles []string
+	for _, entry := range entries {
+		switch filepath.Ext(entry.Name()) {
+		case ".vm":
+			vmFiles = append(vmFiles, filepath.Join(dir, entry.Name()))
+		case ".jack":
+			jackFiles = append(jackFiles, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	var files []token.File
+	switch {
+	case len(vmFiles) > 0:
+		for _, path := range vmFiles {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("reading file %s: %w", path, err)
+			}
+			file, err := translator.ParseFile(strings.TrimSuffix(filepath.Base(path), ".vm"), string(content))
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+		}
+	case len(jackFiles) > 0:
+		for _, path := range jackFiles {
+			file, err := compileClass(path)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+		}
+	default:
+		return nil, fmt.Errorf("no .vm or .jack files found in %s", dir)
+	}
+	return files, nil
+}
+
+// compileClass compiles one .jack file. Its errors are listed one per line
+// with their positions.
+func compileClass(path string) (token.File, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return token.File{}, fmt.Errorf("reading file %s: %w", path, err)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), ".jack")
+	w := vmwriter.New()
+	if err := compilationengine.New(name, tokenizer.New(filepath.Base(path), string(content)), w).CompileClass(); err != nil {
+		return token.File{}, err
+	}
+	return token.NewFile(name, w.Commands), nil
+}
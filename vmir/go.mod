@@ -0,0 +1,3 @@
+module github.com/youchann/nand2tetris/vmir
+
+go 1.23.2
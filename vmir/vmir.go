@@ -0,0 +1,209 @@
+// Package vmir is the typed form of VM code shared by the VM tools: the Jack
+// compiler produces it, and the VM translators, optimizer and analyses
+// consume it.
+package vmir
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type Opcode string
+
+const (
+	Add      Opcode = "add"
+	Sub      Opcode = "sub"
+	Neg      Opcode = "neg"
+	Eq       Opcode = "eq"
+	Gt       Opcode = "gt"
+	Lt       Opcode = "lt"
+	And      Opcode = "and"
+	Or       Opcode = "or"
+	Not      Opcode = "not"
+	Push     Opcode = "push"
+	Pop      Opcode = "pop"
+	Label    Opcode = "label"
+	Goto     Opcode = "goto"
+	IfGoto   Opcode = "if-goto"
+	Function Opcode = "function"
+	Call     Opcode = "call"
+	Return   Opcode = "return"
+)
+
+var opcodes = map[Opcode]bool{
+	Add: true, Sub: true, Neg: true, Eq: true, Gt: true, Lt: true, And: true, Or: true, Not: true,
+	Push: true, Pop: true, Label: true, Goto: true, IfGoto: true, Function: true, Call: true, Return: true,
+}
+
+// IsArithmetic reports whether op is one of the arithmetic and logical
+// commands, which take no arguments.
+func (op Opcode) IsArithmetic() bool {
+	switch op {
+	case Add, Sub, Neg, Eq, Gt, Lt, And, Or, Not:
+		return true
+	}
+	return false
+}
+
+type Segment string
+
+const (
+	Local    Segment = "local"
+	Argument Segment = "argument"
+	This     Segment = "this"
+	That     Segment = "that"
+	Pointer  Segment = "pointer"
+	Temp     Segment = "temp"
+	Constant Segment = "constant"
+	Static   Segment = "static"
+)
+
+var segments = map[Segment]bool{
+	Local: true, Argument: true, This: true, That: true, Pointer: true, Temp: true, Constant: true, Static: true,
+}
+
+// Pos is the position of a command in its source. File is the file name
+// without the extension; Line is 1-based, 0 if unknown.
+type Pos struct {
+	File string
+	Line int
+}
+
+func (p Pos) String() string {
+	return p.File + ".vm:" + strconv.Itoa(p.Line)
+}
+
+// Command is one VM command. Segment and Index are set for push and pop.
+// Name is the label of label, goto and if-goto and the function of function
+// and call, whose Index holds the number of locals or arguments.
+type Command struct {
+	Op      Opcode
+	Segment Segment
+	Index   int
+	Name    string
+	Pos     Pos
+}
+
+// String returns the command as it is written in a .vm file.
+func (c Command) String() string {
+	switch c.Op {
+	case Push, Pop:
+		return string(c.Op) + " " + string(c.Segment) + " " + strconv.Itoa(c.Index)
+	case Label, Goto, IfGoto:
+		return string(c.Op) + " " + c.Name
+	case Function, Call:
+		return string(c.Op) + " " + c.Name + " " + strconv.Itoa(c.Index)
+	default:
+		return string(c.Op)
+	}
+}
+
+// Parse parses the content of a .vm file. file is the file name without the
+// extension and becomes the File of every position.
+func Parse(file, content string) ([]Command, error) {
+	var commands []Command
+	for i, line := range strings.Split(content, "\n") {
+		if idx := strings.Index(line, "//"); idx != -1 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		pos := Pos{File: file, Line: i + 1}
+		command, err := parseCommand(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pos, err)
+		}
+		command.Pos = pos
+		commands = append(commands, command)
+	}
+	return commands, nil
+}
+
+func parseCommand(fields []string) (Command, error) {
+	op := Opcode(fields[0])
+	if !opcodes[op] {
+		return Command{}, fmt.Errorf("unknown command %q", fields[0])
+	}
+	var want int
+	switch op {
+	case Push, Pop, Function, Call:
+		want = 2
+	case Label, Goto, IfGoto:
+		want = 1
+	}
+	if len(fields)-1 != want {
+		return Command{}, fmt.Errorf("%s takes %d arguments, got %d", op, want, len(fields)-1)
+	}
+
+	command := Command{Op: op}
+	switch op {
+	case Push, Pop:
+		command.Segment = Segment(fields[1])
+		if !segments[command.Segment] {
+			return Command{}, fmt.Errorf("unknown segment %q", fields[1])
+		}
+	case Label, Goto, IfGoto, Function, Call:
+		command.Name = fields[1]
+	}
+	if want == 2 {
+		index, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return Command{}, fmt.Errorf("invalid number %q", fields[2])
+		}
+		// Constants may be negative; the translators check their range.
+		if index < 0 && command.Segment != Constant {
+			return Command{}, fmt.Errorf("negative number %d", index)
+		}
+		command.Index = index
+	}
+	return command, nil
+}
+
+// Writer consumes commands one at a time, such as the Jack compiler's VM
+// writer or a translator.
+type Writer interface {
+	WriteCommand(command Command) error
+}
+
+// Printer writes commands as .vm text, indented like the output of the Jack
+// compiler.
+type Printer struct {
+	w io.Writer
+}
+
+func NewPrinter(w io.Writer) *Printer {
+	return &Printer{w: w}
+}
+
+func (p *Printer) WriteCommand(command Command) error {
+	indent := "    "
+	if command.Op == Function || command.Op == Label {
+		indent = ""
+	}
+	_, err := io.WriteString(p.w, indent+command.String()+"\n")
+	return err
+}
+
+// Format returns commands as .vm text, as written by a Printer.
+func Format(commands []Command) string {
+	var b strings.Builder
+	p := NewPrinter(&b)
+	for _, command := range commands {
+		p.WriteCommand(command)
+	}
+	return b.String()
+}
+
+// WriteAll passes commands to w in order and stops at the first error.
+func WriteAll(w Writer, commands []Command) error {
+	for _, command := range commands {
+		if err := w.WriteCommand(command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/youchann/nand2tetris/08/token"
+	"github.com/youchann/nand2tetris/vmir"
+)
+
+// Checks reported by Lint.
+const (
+	CheckUndefined   = "undefined"
+	CheckLabel       = "label"
+	CheckReturn      = "return"
+	CheckArgs        = "args"
+	CheckUnreachable = "unreachable"
+	CheckPopConstant = "pop-constant"
+)
+
+type Problem struct {
+	File    string
+	Line    int
+	Check   string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s.vm:%d: %s [%s]", p.File, p.Line, p.Message, p.Check)
+}
+
+// scope is a function, or the commands that precede the first function of
+// a file, which have no name. Labels are local to a scope.
+type scope struct {
+	file     string
+	name     string
+	commands []vmir.Command
+}
+
+type callSite struct {
+	file    string
+	line    int
+	numArgs int
+}
+
+// Lint checks files as one program and returns the problems ordered by file
+// and line. Calls to undefined functions of the external classes, which are
+// linked from elsewhere, are not reported.
+func Lint(files []token.File, external []string) []Problem {
+	var problems []Problem
+	defined := map[string]bool{}
+	var scopes []scope
+	for _, file := range files {
+		current := scope{file: file.Name}
+		for _, command := range file.IR() {
+			if command.Op == vmir.Function {
+				scopes = append(scopes, current)
+				current = scope{file: file.Name, name: command.Name}
+				defined[command.Name] = true
+			}
+			current.commands = append(current.commands, command)
+		}
+		scopes = append(scopes, current)
+	}
+
+	calls := map[string][]callSite{}
+	var callees []string // in order of the first call
+	for _, s := range scopes {
+		problems = append(problems, s.lint()...)
+		for _, command := range s.commands {
+			if command.Op != vmir.Call {
+				continue
+			}
+			if !defined[command.Name] && !isExternal(command.Name, external) {
+				problems = append(problems, Problem{s.file, command.Pos.Line, CheckUndefined, "call to undefined function " + command.Name})
+			}
+			if calls[command.Name] == nil {
+				callees = append(callees, command.Name)
+			}
+			calls[command.Name] = append(calls[command.Name], callSite{s.file, command.Pos.Line, command.Index})
+		}
+	}
+	for _, callee := range callees {
+		first := calls[callee][0]
+		for _, site := range calls[callee][1:] {
+			if site.numArgs != first.numArgs {
+				message := fmt.Sprintf("%s called with %d arguments, but with %d at %s.vm:%d", callee, site.numArgs, first.numArgs, first.file, first.line)
+				problems = append(problems, Problem{site.file, site.line, CheckArgs, message})
+			}
+		}
+	}
+
+	order := map[string]int{}
+	for i, file := range files {
+		order[file.Name] = i
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return order[problems[i].File] < order[problems[j].File]
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	return problems
+}
+
+func isExternal(function string, classes []string) bool {
+	for _, class := range classes {
+		if strings.HasPrefix(function, class+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// lint checks the labels and the control flow of the scope. It follows
+// every path from the first command to find the code that cannot run and
+// whether a function can run past its last command.
+func (s scope) lint() []Problem {
+	var problems []Problem
+	report := func(command vmir.Command, check, message string) {
+		problems = append(problems, Problem{s.file, command.Pos.Line, check, message})
+	}
+	where := "outside functions"
+	if s.name != "" {
+		where = "in " + s.name
+	}
+	labels := map[string]int{}
+	for i, command := range s.commands {
+		if command.Op != vmir.Label {
+			continue
+		}
+		if first, ok := labels[command.Name]; ok {
+			report(command, CheckLabel, fmt.Sprintf("label %s is already defined %s at %s.vm:%d", command.Name, where, s.file, s.commands[first].Pos.Line))
+			continue
+		}
+		labels[command.Name] = i
+	}
+	for _, command := range s.commands {
+		switch command.Op {
+		case vmir.Goto, vmir.IfGoto:
+			if _, ok := labels[command.Name]; !ok {
+				report(command, CheckLabel, fmt.Sprintf("label %s is not defined %s", command.Name, where))
+			}
+		case vmir.Pop:
+			if command.Segment == vmir.Constant {
+				report(command, CheckPopConstant, "pop to the constant segment")
+			}
+		}
+	}
+
+	reachable := make([]bool, len(s.commands))
+	fallsOff := false
+	work := []int{0}
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		if i >= len(s.commands) {
+			fallsOff = true
+			continue
+		}
+		if reachable[i] {
+			continue
+		}
+		reachable[i] = true
+		command := s.commands[i]
+		switch command.Op {
+		case vmir.Goto:
+			if target, ok := labels[command.Name]; ok {
+				work = append(work, target)
+			}
+		case vmir.IfGoto:
+			if target, ok := labels[command.Name]; ok {
+				work = append(work, target)
+			}
+			work = append(work, i+1)
+		case vmir.Return:
+		default:
+			work = append(work, i+1)
+		}
+	}
+
+	// Report each run of unreachable commands once, at its first command
+	// that is not a label. Runs of labels alone, such as the end label of an
+	// if statement whose branches both return, are no code.
+	for start := 1; start < len(s.commands); start++ {
+		if reachable[start] || !reachable[start-1] {
+			continue
+		}
+		for i := start; i < len(s.commands) && !reachable[i]; i++ {
+			if s.commands[i].Op != vmir.Label {
+				report(s.commands[i], CheckUnreachable, "unreachable code after "+s.commands[start-1].String())
+				break
+			}
+		}
+	}
+
+	if fallsOff && s.name != "" {
+		report(s.commands[len(s.commands)-1], CheckReturn, s.name+" can run past its last command without return")
+	}
+	return problems
+}
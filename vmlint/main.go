@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/youchann/nand2tetris/08/token"
+	"github.com/youchann/nand2tetris/08/translator"
+	"github.com/youchann/nand2tetris/vmlint/lint"
+)
+
+// osClasses are the classes of the Jack OS, which compiled programs call
+// without defining them.
+var osClasses = []string{"Array", "Keyboard", "Math", "Memory", "Output", "Screen", "String", "Sys"}
+
+func main() {
+	withOS := flag.Bool("os", false, "do not report calls to undefined functions of the Jack OS classes")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Println("Usage: go run main.go [flags] [filename.vm or directory]")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	path := flag.Arg(0)
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error accessing path: %v\n", err)
+		os.Exit(1)
+	}
+	var vmFiles []string
+	if fileInfo.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading directory: %v\n", err)
+			os.Exit(1)
+		}
+		for _, entry := range entries {
+			if filepath.Ext(entry.Name()) == ".vm" {
+				vmFiles = append(vmFiles, filepath.Join(path, entry.Name()))
+			}
+		}
+		if len(vmFiles) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: No .vm files found in directory\n")
+			os.Exit(1)
+		}
+	} else {
+		if filepath.Ext(path) != ".vm" {
+			fmt.Fprintf(os.Stderr, "Error: File must have .vm extension\n")
+			os.Exit(1)
+		}
+		vmFiles = append(vmFiles, path)
+	}
+
+	var files []token.File
+	for _, filename := range vmFiles {
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+			os.Exit(1)
+		}
+		file, err := translator.ParseFile(strings.TrimSuffix(filepath.Base(filename), ".vm"), string(content))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		files = append(files, file)
+	}
+
+	var external []string
+	if *withOS {
+		external = osClasses
+	}
+	problems := lint.Lint(files, external)
+	dir := filepath.Dir(vmFiles[0]) + string(filepath.Separator)
+	for _, p := range problems {
+		fmt.Println(dir + p.String())
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}